@@ -3,14 +3,19 @@ package main
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
 	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/io-developer/go-davsync/pkg/client/local"
 	"github.com/io-developer/go-davsync/pkg/client/webdav"
 	"github.com/io-developer/go-davsync/pkg/client/yadiskrest"
+	"github.com/io-developer/go-davsync/pkg/filter"
 	"github.com/io-developer/go-davsync/pkg/log"
 	"github.com/io-developer/go-davsync/pkg/synchronizer"
+	"github.com/io-developer/go-davsync/pkg/util"
 )
 
 // Args of cli
@@ -28,14 +33,93 @@ type Args struct {
 	syncConfigFile string
 
 	// std sync flags
-	threads     uint
-	attempts    uint
-	allowDelete bool
+	threads      uint
+	attempts     uint
+	allowDelete  bool
+	mirror       bool
+	detectMoves  bool
+	dedup        bool
+	maxDelete    int
+	maxDeletePct float64
+	force        bool
+	overwrite    string
+	modifyWindow time.Duration
+	dryRun       bool
+	planFormat   string
+	statePath    string
+	conflict     string
+	reportPath   string
+	bwlimit      string
+	inFlight     string
+	queueOrder   string
+
+	// manifest flags
+	manifestPath   string
+	manifestSample int
+	refreshOutput  bool
+
+	// watch flags
+	watch          bool
+	watchDebounce  time.Duration
+	watchReconcile time.Duration
+	watchPoll      time.Duration
+
+	// journal flags
+	journalPath string
+	resume      bool
+
+	// snapshot flags
+	snapshot          bool
+	snapshotKeepAge   time.Duration
+	snapshotKeepCount int
+
+	// backup flags
+	backupDir       string
+	backupKeepAge   time.Duration
+	backupKeepCount int
+
+	// filter flags
+	filterRules []filter.Rule
+	minSize     string
+	maxSize     string
+	minAge      time.Duration
+	maxAge      time.Duration
+}
+
+// ruleFlag appends rules of single action keeping order across flags
+type ruleFlag struct {
+	rules    *[]filter.Rule
+	action   filter.Action
+	fromFile bool
+}
+
+func (f ruleFlag) String() string {
+	return ""
+}
+
+func (f ruleFlag) Set(value string) error {
+	if f.fromFile {
+		rules, err := filter.ParseRulesFile(value)
+		if err != nil {
+			return err
+		}
+		*f.rules = append(*f.rules, rules...)
+		return nil
+	}
+	rule := filter.Rule{Action: f.action, Pattern: value}
+	if strings.HasPrefix(value, "regex:") {
+		rule.Regex = true
+		rule.Pattern = strings.TrimPrefix(value, "regex:")
+	}
+	*f.rules = append(*f.rules, rule)
+	return nil
 }
 
 var defaultLocalOptions = local.Options{
-	DirMode:  0755,
-	FileMode: 0644,
+	DirMode:     0755,
+	FileMode:    0644,
+	IgnoreFile:  ".davsyncignore",
+	HashWorkers: 4,
 }
 
 var defaultWebdavOptions = webdav.Options{
@@ -63,35 +147,95 @@ var defaultOutputClientConfig = ClientConfig{
 }
 
 var defaultSyncConfig = SyncConfig{
-	Type: SyncTypeOneWay,
+	Type:       SyncTypeOneWay,
+	PlanFormat: PlanFormatText,
 	OneWay: synchronizer.OneWayOpt{
-		IndirectUpload:         true,
-		IgnoreExisting:         true,
-		AllowDelete:            false,            // append-only mode by default
-		SingleThreadedFileSize: 64 * 1024 * 1024, // 64 MiB
-		ThreadCount:            4,
-		AttemptMax:             3,
-		AttemptDelay:           30 * time.Second,
-		UploadCheckDelay:       10 * time.Second,
-		UploadCheckTimeout:     30 * time.Minute,
+		Overwrite:          synchronizer.OverwriteChanged,
+		ModifyWindow:       2 * time.Second,
+		IndirectUpload:     true,
+		AllowDelete:        false, // append-only mode by default
+		ThreadCount:        4,
+		MaxInFlightBytes:   256 * 1024 * 1024, // 256 MiB
+		QueueOrder:         synchronizer.QueuePath,
+		AttemptMax:         3,
+		AttemptDelay:       30 * time.Second,
+		UploadCheckDelay:   10 * time.Second,
+		UploadCheckTimeout: 30 * time.Minute,
+	},
+	TwoWay: synchronizer.TwoWayOpt{
+		StatePath:    ".davsync-state.json",
+		Conflict:     synchronizer.ConflictKeepNewer,
+		ModifyWindow: 2 * time.Second,
 	},
 }
 
-func parseArgs() (args Args, err error) {
-	flag.StringVar(&args.input, "i", "./", "Default input directory path. Example: /tmp/test")
-	flag.StringVar(&args.inputConfigFile, "iconf", "", "Input client config JSON file")
+// parseArgs parses sync flags, flags of daemon jobs are parsed the same way
+func parseArgs(flags *flag.FlagSet, arguments []string) (args Args, err error) {
+	flags.StringVar(&args.input, "i", "./", "Default input directory path. Example: /tmp/test")
+	flags.StringVar(&args.inputConfigFile, "iconf", "", "Input client config JSON file")
+
+	flags.StringVar(&args.output, "o", "/", "Default output directory path. Example: /test")
+	flags.StringVar(&args.outputConfigFile, "oconf", ".davsync", "Output client config JSON file")
 
-	flag.StringVar(&args.output, "o", "/", "Default output directory path. Example: /test")
-	flag.StringVar(&args.outputConfigFile, "oconf", ".davsync", "Output client config JSON file")
+	flags.UintVar(&args.threads, "threads", 4, "Max threads")
+	flags.UintVar(&args.attempts, "attempts", 3, "Max attempts")
+	flags.StringVar(&args.inFlight, "inflight-bytes", "256M", "Max bytes of files uploaded by all threads at once, 0 means no limit")
+	flags.StringVar(&args.queueOrder, "queue-order", string(synchronizer.QueuePath), "Upload queue order: Path, SmallestFirst, LargestFirst, NewestFirst")
+	flags.BoolVar(&args.allowDelete, "delete", false, "Allow delete unexpexted resources in output")
+	flags.BoolVar(&args.mirror, "mirror", false, "Mirror mode: like -delete, also deletes output dirs missing in input")
+	flags.BoolVar(&args.detectMoves, "detect-moves", false, "Move output files instead of re-uploading moved input files, requires -delete")
+	flags.BoolVar(&args.dedup, "dedup", false, "Copy output files server-side instead of uploading new input files with the same content")
+	flags.IntVar(&args.maxDelete, "max-delete", 0, "Refuse to sync when more output files and dirs would be deleted, 0 means no limit")
+	flags.Float64Var(&args.maxDeletePct, "max-delete-percent", 0, "Refuse to sync when larger percent of output would be deleted, 0 means no limit")
+	flags.BoolVar(&args.force, "force", false, "Delete even when input is empty or unreadable, or delete limits are exceeded")
+	flags.StringVar(&args.overwrite, "overwrite", string(synchronizer.OverwriteChanged), "Overwrite policy for existing files: Never, Changed, SizeDiffers, Newer, ChecksumDiffers, Always")
+	flags.DurationVar(&args.modifyWindow, "modify-window", 2*time.Second, "Max mtime difference treated as equal by Newer/Changed policies")
 
-	flag.UintVar(&args.threads, "threads", 4, "Max threads")
-	flag.UintVar(&args.attempts, "attempts", 3, "Max attempts")
-	flag.BoolVar(&args.allowDelete, "delete", false, "Allow delete unexpexted resources in output")
+	flags.BoolVar(&args.dryRun, "dry-run", false, "Print sync plan without touching output")
+	flags.StringVar(&args.planFormat, "plan-format", string(PlanFormatText), "Dry-run plan format: text, json")
 
-	flag.StringVar(&args.sync, "sync", "OneWay", "Default sync type")
-	flag.StringVar(&args.syncConfigFile, "syncConf", "", "Sync config JSON file")
+	flags.StringVar(&args.statePath, "state", ".davsync-state.json", "TwoWay sync state file")
+	flags.StringVar(&args.conflict, "conflict", string(synchronizer.ConflictKeepNewer), "TwoWay conflict policy: KeepNewer, KeepBoth, PreferInput, PreferOutput")
 
-	flag.Parse()
+	flags.Var(ruleFlag{&args.filterRules, filter.Exclude, false}, "exclude", "Exclude paths matching gitignore-style glob, or regex with 'regex:' prefix. Repeatable, last matching -exclude/-include/-exclude-from rule wins")
+	flags.Var(ruleFlag{&args.filterRules, filter.Include, false}, "include", "Include paths matching glob or 'regex:' pattern. Repeatable")
+	flags.Var(ruleFlag{&args.filterRules, filter.Exclude, true}, "exclude-from", "Read gitignore-style rules from file, '!' lines are includes. Repeatable")
+	flags.StringVar(&args.minSize, "min-size", "", "Skip files smaller than size. Example: 10K")
+	flags.StringVar(&args.maxSize, "max-size", "", "Skip files larger than size. Example: 2G")
+	flags.DurationVar(&args.minAge, "min-age", 0, "Skip files modified more recently than duration")
+	flags.DurationVar(&args.maxAge, "max-age", 0, "Skip files modified earlier than duration ago")
+
+	flags.StringVar(&args.manifestPath, "manifest", "", "Output tree manifest file. When set, output tree is read from it instead of the server")
+	flags.IntVar(&args.manifestSample, "manifest-sample", 16, "Number of random manifest entries checked against output, full read on drift")
+	flags.BoolVar(&args.refreshOutput, "refresh-output", false, "Read output tree from the server even if manifest exists")
+
+	flags.BoolVar(&args.watch, "watch", false, "Keep running and sync input changes continuously, OneWay only")
+	flags.DurationVar(&args.watchDebounce, "watch-debounce", 2*time.Second, "Quiet period after the last input change before sync")
+	flags.DurationVar(&args.watchReconcile, "watch-reconcile", time.Hour, "Interval of full diff catching missed changes, 0 disables it")
+	flags.DurationVar(&args.watchPoll, "watch-poll", 0, "Poll input tree with interval instead of filesystem notifications")
+
+	flags.StringVar(&args.journalPath, "journal", "", "Write-ahead journal file of sync operations, removed after successful sync")
+	flags.BoolVar(&args.resume, "resume", false, "Continue interrupted sync from -journal without re-planning")
+
+	flags.BoolVar(&args.snapshot, "snapshot", false, "Sync into a new dated dir of output made as server-side copy of the previous one, OneWay only")
+	flags.DurationVar(&args.snapshotKeepAge, "snapshot-keep-age", 0, "Delete snapshots older than duration, 0 keeps them")
+	flags.IntVar(&args.snapshotKeepCount, "snapshot-keep-count", 0, "Keep only this many newest snapshots, 0 keeps all")
+
+	flags.StringVar(&args.backupDir, "backup-dir", "", "Output dir receiving deleted and overwritten files, one dated subdir per run. Example: /.davsync-backup")
+	flags.DurationVar(&args.backupKeepAge, "backup-keep-age", 0, "Delete backup runs older than duration, 0 keeps them")
+	flags.IntVar(&args.backupKeepCount, "backup-keep-count", 0, "Keep only this many newest backup runs, 0 keeps all")
+
+	flags.StringVar(&args.bwlimit, "bwlimit", "", "Bandwidth limit shared by all threads, bytes per second. Example: 2M or '08:00-19:00 2M, otherwise unlimited'")
+
+	flags.StringVar(&args.reportPath, "report", "", "Write sync report JSON to file")
+
+	flags.StringVar(&args.sync, "sync", "OneWay", "Default sync type: OneWay, TwoWay")
+	flags.StringVar(&args.syncConfigFile, "syncConf", "", "Sync config JSON file")
+
+	err = flags.Parse(arguments)
+	if err != nil {
+		return
+	}
 
 	args.inputConfig = defaultInputClientConfig
 	err = parseClientConfig(args.inputConfigFile, &args.inputConfig, args.input)
@@ -135,9 +279,63 @@ func parseClientConfig(path string, outConf *ClientConfig, baseDir string) error
 }
 
 func parseSyncConfig(path string, outConf *SyncConfig, args Args) error {
+	outConf.Type = SyncType(args.sync)
+	outConf.DryRun = args.dryRun
+	outConf.PlanFormat = PlanFormat(args.planFormat)
 	outConf.OneWay.ThreadCount = args.threads
 	outConf.OneWay.AttemptMax = args.attempts
+	outConf.OneWay.QueueOrder = synchronizer.QueueOrder(args.queueOrder)
 	outConf.OneWay.AllowDelete = args.allowDelete
+	outConf.OneWay.Mirror = args.mirror
+	outConf.OneWay.DetectMoves = args.detectMoves
+	outConf.OneWay.Dedup = args.dedup
+	outConf.OneWay.MaxDelete = args.maxDelete
+	outConf.OneWay.MaxDeletePercent = args.maxDeletePct
+	outConf.OneWay.Force = args.force
+	outConf.OneWay.Overwrite = synchronizer.OverwritePolicy(args.overwrite)
+	outConf.OneWay.ModifyWindow = args.modifyWindow
+	outConf.OneWay.ManifestPath = args.manifestPath
+	outConf.OneWay.ManifestSample = args.manifestSample
+	outConf.OneWay.RefreshOutput = args.refreshOutput
+	outConf.Watch = args.watch
+	outConf.WatchOpt.Debounce = args.watchDebounce
+	outConf.WatchOpt.ReconcileInterval = args.watchReconcile
+	outConf.WatchPoll = args.watchPoll
+	outConf.OneWay.JournalPath = args.journalPath
+	outConf.Resume = args.resume
+	outConf.Snapshot = args.snapshot
+	outConf.SnapshotOpt.KeepAge = args.snapshotKeepAge
+	outConf.SnapshotOpt.KeepCount = args.snapshotKeepCount
+	outConf.OneWay.BackupDir = args.backupDir
+	outConf.OneWay.BackupKeepAge = args.backupKeepAge
+	outConf.OneWay.BackupKeepCount = args.backupKeepCount
+	outConf.TwoWay.StatePath = args.statePath
+	outConf.TwoWay.Conflict = synchronizer.ConflictPolicy(args.conflict)
+	outConf.TwoWay.ModifyWindow = args.modifyWindow
+	outConf.BandwidthLimit = args.bwlimit
+	outConf.Filter.MinAge = args.minAge
+	outConf.Filter.MaxAge = args.maxAge
+	if args.inFlight != "" {
+		size, err := util.ParseBytes(args.inFlight)
+		if err != nil {
+			return err
+		}
+		outConf.OneWay.MaxInFlightBytes = size
+	}
+	if args.minSize != "" {
+		size, err := util.ParseBytes(args.minSize)
+		if err != nil {
+			return err
+		}
+		outConf.Filter.MinSize = size
+	}
+	if args.maxSize != "" {
+		size, err := util.ParseBytes(args.maxSize)
+		if err != nil {
+			return err
+		}
+		outConf.Filter.MaxSize = size
+	}
 
 	if path != "" {
 		var bytes []byte
@@ -151,5 +349,113 @@ func parseSyncConfig(path string, outConf *SyncConfig, args Args) error {
 			return err
 		}
 	}
+	// the last matching rule wins: CLI rules override JSON ones,
+	// own files are never synced
+	rules := append([]filter.Rule{}, outConf.Filter.Rules...)
+	rules = append(rules, args.filterRules...)
+	if args.inputConfig.Type == ClientTypeLocal {
+		rules = append(rules, ownFileRules(
+			args.input,
+			args.inputConfigFile,
+			args.outputConfigFile,
+			path,
+			outConf.TwoWay.StatePath,
+			outConf.OneWay.ManifestPath,
+			outConf.OneWay.JournalPath,
+			args.inputConfig.LocalOptions.HashCache,
+			args.outputConfig.LocalOptions.HashCache,
+			args.reportPath,
+		)...)
+	}
+	outConf.Filter.Rules = rules
+	f, err := filter.New(outConf.Filter)
+	if err != nil {
+		return err
+	}
+	outConf.OneWay.Filter = f
+
+	if outConf.BandwidthLimit != "" {
+		rateFn, err := util.ParseRateSchedule(outConf.BandwidthLimit)
+		if err != nil {
+			return err
+		}
+		outConf.OneWay.Limiter = util.NewScheduledLimiter(rateFn)
+	}
+
+	if outConf.PlanFormat != PlanFormatText && outConf.PlanFormat != PlanFormatJSON {
+		return fmt.Errorf("Unexpected plan format '%s'", outConf.PlanFormat)
+	}
+	if !outConf.TwoWay.Conflict.IsValid() {
+		return fmt.Errorf("Unexpected conflict policy '%s'", outConf.TwoWay.Conflict)
+	}
+	if outConf.Type != SyncTypeOneWay && outConf.Type != SyncTypeTwoWay {
+		return fmt.Errorf("Unexpected sync-type '%s'", outConf.Type)
+	}
+	if (outConf.DryRun || outConf.Watch) && outConf.Type != SyncTypeOneWay {
+		return fmt.Errorf("Dry-run and watch are not supported by sync-type '%s'", outConf.Type)
+	}
+	if outConf.Watch && (outConf.DryRun || outConf.Resume) {
+		return fmt.Errorf("Unexpected -watch with -dry-run or -resume")
+	}
+	if outConf.Resume && outConf.OneWay.JournalPath == "" {
+		return fmt.Errorf("Unexpected -resume without -journal")
+	}
+	if outConf.Snapshot {
+		if outConf.Type != SyncTypeOneWay {
+			return fmt.Errorf("Snapshot is not supported by sync-type '%s'", outConf.Type)
+		}
+		if outConf.DryRun || outConf.Watch || outConf.Resume {
+			return fmt.Errorf("Unexpected -snapshot with -dry-run, -watch or -resume")
+		}
+	}
+	if outConf.OneWay.BackupDir != "" {
+		if util.PathNormalize(outConf.OneWay.BackupDir, true) == "/" {
+			return fmt.Errorf("Unexpected backup dir '%s'", outConf.OneWay.BackupDir)
+		}
+		if outConf.Type != SyncTypeOneWay {
+			return fmt.Errorf("Backup dir is not supported by sync-type '%s'", outConf.Type)
+		}
+	}
+	if err := outConf.Hooks.validate(); err != nil {
+		return err
+	}
+	if len(outConf.Hooks.PostUpload) > 0 && outConf.Type != SyncTypeOneWay {
+		return fmt.Errorf("PostUpload hooks are not supported by sync-type '%s'", outConf.Type)
+	}
+	if !outConf.OneWay.QueueOrder.IsValid() {
+		return fmt.Errorf("Unexpected queue order '%s'", outConf.OneWay.QueueOrder)
+	}
+	if !outConf.OneWay.Overwrite.IsValid() {
+		return fmt.Errorf("Unexpected overwrite policy '%s'", outConf.OneWay.Overwrite)
+	}
 	return nil
 }
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`)
+
+// ownFileRules excludes davsync config and state files found inside input dir
+func ownFileRules(inputDir string, paths ...string) []filter.Rule {
+	rules := []filter.Rule{}
+	absInput, err := filepath.Abs(inputDir)
+	if err != nil {
+		return rules
+	}
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(absInput, absPath)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rules = append(rules, filter.Rule{
+			Action:  filter.Exclude,
+			Pattern: "/" + globEscaper.Replace(filepath.ToSlash(rel)),
+		})
+	}
+	return rules
+}
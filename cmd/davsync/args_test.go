@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+)
+
+func TestParseArgsOwnFilesStayExcluded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "args")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"local.json": `{"Type": "Local"}`,
+		"sync.json":  `{"Filter": {"Rules": [{"Action": "Exclude", "Pattern": "*.txt"}]}}`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	args, err := parseArgs(flag.NewFlagSet("test", flag.ContinueOnError), []string{
+		"-i", dir,
+		"-iconf", filepath.Join(dir, "local.json"),
+		"-oconf", filepath.Join(dir, "local.json"),
+		"-syncConf", filepath.Join(dir, "sync.json"),
+		"-manifest", filepath.Join(dir, "manifest.json"),
+		"-report", filepath.Join(dir, "report.json"),
+		"-include", "*",
+		"-include", "*.txt",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := args.syncConfig.OneWay.Filter
+	tests := map[string]bool{
+		"/local.json":    false,
+		"/sync.json":     false,
+		"/manifest.json": false,
+		"/report.json":   false,
+		"/a.json":        true,
+		// CLI include overrides JSON exclude
+		"/a.txt": true,
+	}
+	for path, included := range tests {
+		if f.Match(path, client.Resource{Path: path}) != included {
+			t.Errorf("%s: expected included %t", path, included)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/log"
+	"github.com/io-developer/go-davsync/pkg/schedule"
+	"github.com/io-developer/go-davsync/pkg/synchronizer"
+)
+
+// DaemonConfig of daemon mode
+type DaemonConfig struct {
+	Listen string
+	Jobs   []JobConfig
+}
+
+// JobConfig is a sync job run on schedule, Args are the usual sync flags
+type JobConfig struct {
+	Name     string
+	Schedule string
+	Args     []string
+}
+
+// JobStatus is served by status endpoint
+type JobStatus struct {
+	Name       string
+	Schedule   string
+	Running    bool
+	NextRun    time.Time
+	LastStart  time.Time
+	LastFinish time.Time
+	Runs       int
+	Skipped    int
+	LastStatus synchronizer.ReportStatus `json:",omitempty"`
+	LastError  string                    `json:",omitempty"`
+	LastReport *synchronizer.SyncReport  `json:",omitempty"`
+	InFlight   []log.ThreadLog
+}
+
+type inFlighter interface {
+	InFlight() []log.ThreadLog
+}
+
+type daemonJob struct {
+	name     string
+	expr     string
+	schedule *schedule.Schedule
+	argv     []string
+
+	mu     sync.Mutex
+	status JobStatus
+	sync   stopper
+}
+
+type daemon struct {
+	conf      DaemonConfig
+	jobs      []*daemonJob
+	startedAt time.Time
+	stopping  chan struct{}
+	stopOnce  sync.Once
+	runs      sync.WaitGroup
+}
+
+var defaultDaemonConfig = DaemonConfig{
+	Listen: "127.0.0.1:8377",
+}
+
+func runDaemon(arguments []string) int {
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	configPath := flags.String("config", "davsync-daemon.json", "Daemon config JSON file with jobs")
+	listen := flags.String("listen", "", "Status HTTP endpoint address, overrides Listen of config")
+	flags.Parse(arguments)
+
+	conf, err := parseDaemonConfig(*configPath)
+	if err != nil {
+		return fail(ExitConfig, "Error at daemon config parsing", err)
+	}
+	if *listen != "" {
+		conf.Listen = *listen
+	}
+	d, err := newDaemon(conf)
+	if err != nil {
+		return fail(ExitConfig, "Daemon creation error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	release := watchSignals(d, cancel)
+	defer release()
+
+	err = d.run(ctx)
+	if err != nil {
+		return fail(ExitFailure, "Daemon error", err)
+	}
+	log.Info("\n\nDone.")
+	return ExitOK
+}
+
+func parseDaemonConfig(path string) (conf DaemonConfig, err error) {
+	conf = defaultDaemonConfig
+	bytes, err := ioutil.ReadFile(path)
+	log.Debug("parseDaemonConfig bytes", path, string(bytes))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(bytes, &conf)
+	return
+}
+
+func newDaemon(conf DaemonConfig) (*daemon, error) {
+	if len(conf.Jobs) == 0 {
+		return nil, fmt.Errorf("Unexpected daemon config without jobs")
+	}
+	d := &daemon{
+		conf:     conf,
+		stopping: make(chan struct{}),
+	}
+	names := map[string]bool{}
+	for _, jobConf := range conf.Jobs {
+		if jobConf.Name == "" || names[jobConf.Name] {
+			return nil, fmt.Errorf("Unexpected job name '%s', names must be unique and non-empty", jobConf.Name)
+		}
+		names[jobConf.Name] = true
+		job, err := newDaemonJob(jobConf)
+		if err != nil {
+			return nil, err
+		}
+		d.jobs = append(d.jobs, job)
+	}
+	return d, nil
+}
+
+func newDaemonJob(conf JobConfig) (*daemonJob, error) {
+	s, err := schedule.Parse(conf.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("Job '%s': %v", conf.Name, err)
+	}
+	job := &daemonJob{
+		name:     conf.Name,
+		expr:     conf.Schedule,
+		schedule: s,
+		argv:     conf.Args,
+	}
+	args, err := job.parseArgs()
+	if err != nil {
+		return nil, fmt.Errorf("Job '%s': %v", conf.Name, err)
+	}
+	if args.syncConfig.DryRun || args.syncConfig.Watch {
+		return nil, fmt.Errorf("Job '%s': unexpected -dry-run or -watch", conf.Name)
+	}
+	return job, nil
+}
+
+// parseArgs is called for every run, so filters, -exclude-from files and
+// client configs are of the run rather than of the daemon start
+func (job *daemonJob) parseArgs() (Args, error) {
+	return parseArgs(flag.NewFlagSet(job.name, flag.ContinueOnError), job.argv)
+}
+
+// Stop stops scheduling and asks running jobs to finish in-flight files
+func (d *daemon) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stopping)
+	})
+	for _, job := range d.jobs {
+		job.stop()
+	}
+}
+
+func (d *daemon) isStopping() bool {
+	select {
+	case <-d.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+func (d *daemon) run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", d.conf.Listen)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: d.handler()}
+	go server.Serve(listener)
+	defer server.Close()
+
+	d.startedAt = time.Now()
+	log.Info(fmt.Sprintf("Daemon started with %d jobs, status at http://%s/status", len(d.jobs), listener.Addr()))
+
+	scheduled := sync.WaitGroup{}
+	for _, job := range d.jobs {
+		scheduled.Add(1)
+		go func(job *daemonJob) {
+			defer scheduled.Done()
+			d.scheduleJob(ctx, job)
+		}(job)
+	}
+	scheduled.Wait()
+	d.runs.Wait()
+	return nil
+}
+
+func (d *daemon) scheduleJob(ctx context.Context, job *daemonJob) {
+	for {
+		next := job.schedule.Next(time.Now())
+		job.setNextRun(next)
+		if next.IsZero() {
+			log.Warn("Job", job.name, "has no more runs scheduled")
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-d.stopping:
+			timer.Stop()
+			return
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+		d.runs.Add(1)
+		go func() {
+			defer d.runs.Done()
+			d.runJob(ctx, job)
+		}()
+	}
+}
+
+func (d *daemon) runJob(ctx context.Context, job *daemonJob) {
+	if !job.begin() {
+		log.Warn("Job", job.name, "is still running, scheduled run refused")
+		return
+	}
+	log.Info(fmt.Sprintf("Job '%s' started", job.name))
+
+	report, err := d.syncJob(ctx, job)
+	if err != nil {
+		log.Error(fmt.Sprintf("Job '%s' error", job.name), err)
+	}
+	job.end(report, err)
+	log.Info(fmt.Sprintf("Job '%s' finished: %s", job.name, report.Status()))
+}
+
+func (d *daemon) syncJob(ctx context.Context, job *daemonJob) (report synchronizer.SyncReport, err error) {
+	args, err := job.parseArgs()
+	if err != nil {
+		return
+	}
+	input, err := createClient(args.inputConfig)
+	if err != nil {
+		return
+	}
+	defer closeClient(input)
+	output, err := createClient(args.outputConfig)
+	if err != nil {
+		return
+	}
+	defer closeClient(output)
+	track := func(s stopper) func() {
+		job.setSync(s)
+		if d.isStopping() {
+			s.Stop()
+		}
+		return func() {
+			job.setSync(nil)
+		}
+	}
+	report, err = runSync(ctx, input, output, args.outputConfig, args.syncConfig, nil, track)
+	if err == nil && args.reportPath != "" {
+		err = writeReport(args.reportPath, report)
+	}
+	return
+}
+
+func (job *daemonJob) begin() bool {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	if job.status.Running {
+		job.status.Skipped++
+		return false
+	}
+	job.status.Running = true
+	job.status.LastStart = time.Now()
+	return true
+}
+
+func (job *daemonJob) end(report synchronizer.SyncReport, err error) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.status.Running = false
+	job.status.LastFinish = time.Now()
+	job.status.Runs++
+	job.status.LastStatus = report.Status()
+	job.status.LastReport = &report
+	job.status.LastError = ""
+	if err != nil {
+		job.status.LastStatus = synchronizer.ReportFailure
+		job.status.LastError = err.Error()
+	}
+}
+
+func (job *daemonJob) setNextRun(next time.Time) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.status.NextRun = next
+}
+
+func (job *daemonJob) setSync(s stopper) {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.sync = s
+}
+
+func (job *daemonJob) stop() {
+	job.mu.Lock()
+	s := job.sync
+	job.mu.Unlock()
+	if s != nil {
+		s.Stop()
+	}
+}
+
+func (job *daemonJob) getStatus() JobStatus {
+	job.mu.Lock()
+	status := job.status
+	s := job.sync
+	job.mu.Unlock()
+
+	status.Name = job.name
+	status.Schedule = job.expr
+	status.InFlight = []log.ThreadLog{}
+	if f, ok := s.(inFlighter); ok {
+		status.InFlight = f.InFlight()
+	}
+	return status
+}
+
+func (d *daemon) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		status := "ok"
+		if d.isStopping() {
+			status = "stopping"
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Status    string
+			StartedAt time.Time
+			Jobs      int
+		}{status, d.startedAt, len(d.jobs)})
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("job")
+		statuses := []JobStatus{}
+		for _, job := range d.jobs {
+			if name == "" || name == job.name {
+				statuses = append(statuses, job.getStatus())
+			}
+		}
+		if name == "" {
+			writeJSON(w, http.StatusOK, statuses)
+			return
+		}
+		if len(statuses) == 0 {
+			writeJSON(w, http.StatusNotFound, struct{ Error string }{fmt.Sprintf("Unexpected job '%s'", name)})
+			return
+		}
+		writeJSON(w, http.StatusOK, statuses[0])
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	bytes, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(bytes)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/log"
+	"github.com/io-developer/go-davsync/pkg/synchronizer"
+)
+
+// Hook is an external command. Failure of a Strict one fails the sync,
+// or the upload for PostUpload hooks, others are only logged
+type Hook struct {
+	Command []string
+	Strict  bool
+	Timeout time.Duration
+}
+
+// Hooks of sync config. PreSync and PostSync get SyncReport JSON on stdin,
+// PostUpload get DAVSYNC_* environment variables of uploaded file
+type Hooks struct {
+	PreSync    []Hook
+	PostSync   []Hook
+	PostUpload []Hook
+}
+
+func (h Hooks) validate() error {
+	for _, hooks := range [][]Hook{h.PreSync, h.PostSync, h.PostUpload} {
+		for _, hook := range hooks {
+			if len(hook.Command) == 0 || hook.Command[0] == "" {
+				return fmt.Errorf("Unexpected hook without command")
+			}
+		}
+	}
+	return nil
+}
+
+func (hook Hook) run(ctx context.Context, stdin []byte, env []string) error {
+	if hook.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, hook.Command[0], hook.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("Hook %q failed: %v", hook.Command, err)
+	}
+	return nil
+}
+
+// runSyncHooks runs hooks in order, the first failed strict one stops them
+func runSyncHooks(ctx context.Context, stage string, hooks []Hook, report synchronizer.SyncReport) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+	stdin, err := reportJSON(report)
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		log.Info(fmt.Sprintf("%s hook: %q", stage, hook.Command))
+		err := hook.run(ctx, stdin, nil)
+		if err == nil {
+			continue
+		}
+		if hook.Strict {
+			return err
+		}
+		log.Warn(stage, "hook error, continuing", err)
+	}
+	return nil
+}
+
+// uploadHook runs PostUpload hooks for every uploaded file
+func uploadHook(ctx context.Context, hooks []Hook) func(file synchronizer.UploadedFile) error {
+	return func(file synchronizer.UploadedFile) error {
+		env := []string{
+			"DAVSYNC_PATH=" + file.Path,
+			"DAVSYNC_INPUT_PATH=" + file.InputAbsPath,
+			"DAVSYNC_OUTPUT_PATH=" + file.OutputAbsPath,
+			"DAVSYNC_SIZE=" + strconv.FormatInt(file.Size, 10),
+			"DAVSYNC_MTIME=" + file.ModTime.Format(time.RFC3339),
+			"DAVSYNC_MD5=" + file.HashMd5,
+			"DAVSYNC_SHA256=" + file.HashSha256,
+		}
+		for _, hook := range hooks {
+			err := hook.run(ctx, nil, env)
+			if err == nil {
+				continue
+			}
+			if hook.Strict {
+				return err
+			}
+			log.Warn("PostUpload hook error, continuing", file.Path, err)
+		}
+		return nil
+	}
+}
+
+// withHooks runs sync between PreSync and PostSync hooks. Failed strict
+// PreSync hook aborts the sync, failed strict PostSync one is a report error
+func withHooks(ctx context.Context, hooks Hooks, sync func() (synchronizer.SyncReport, error)) (synchronizer.SyncReport, error) {
+	started := synchronizer.SyncReport{
+		State:     synchronizer.ReportComplete,
+		StartedAt: time.Now(),
+		Errors:    []synchronizer.PathError{},
+	}
+	err := runSyncHooks(ctx, "PreSync", hooks.PreSync, started)
+	if err != nil {
+		log.Error("PreSync hook failed, sync is not started", err)
+		started.State = synchronizer.ReportAborted
+		started.FinishedAt = time.Now()
+		started.Errors = append(started.Errors, synchronizer.PathError{Op: "PreSync", Error: err.Error()})
+		return started, nil
+	}
+
+	report, err := sync()
+	if err != nil {
+		return report, err
+	}
+
+	// notify even about aborted sync
+	err = runSyncHooks(context.Background(), "PostSync", hooks.PostSync, report)
+	if err != nil {
+		log.Error("PostSync hook failed", err)
+		report.Errors = append(report.Errors, synchronizer.PathError{Op: "PostSync", Error: err.Error()})
+	}
+	return report, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/synchronizer"
+)
+
+func TestWithHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	marker := filepath.Join(dir, "marker")
+
+	tests := []struct {
+		name      string
+		hooks     Hooks
+		synced    bool
+		aborted   bool
+		errorOps  []string
+		markerSet bool
+	}{
+		{
+			name:      "passing hooks",
+			hooks:     Hooks{PreSync: []Hook{{Command: []string{"true"}, Strict: true}}, PostSync: []Hook{{Command: []string{"touch", marker}}}},
+			synced:    true,
+			markerSet: true,
+		},
+		{
+			name:     "failed strict PreSync aborts",
+			hooks:    Hooks{PreSync: []Hook{{Command: []string{"false"}, Strict: true}, {Command: []string{"touch", marker}}}},
+			aborted:  true,
+			errorOps: []string{"PreSync"},
+		},
+		{
+			name:      "failed PreSync is logged",
+			hooks:     Hooks{PreSync: []Hook{{Command: []string{"false"}}, {Command: []string{"touch", marker}}}},
+			synced:    true,
+			markerSet: true,
+		},
+		{
+			name:     "timed out strict PreSync aborts",
+			hooks:    Hooks{PreSync: []Hook{{Command: []string{"sleep", "5"}, Strict: true, Timeout: 50 * time.Millisecond}}},
+			aborted:  true,
+			errorOps: []string{"PreSync"},
+		},
+		{
+			name:     "failed strict PostSync is a report error",
+			hooks:    Hooks{PostSync: []Hook{{Command: []string{"false"}, Strict: true}}},
+			synced:   true,
+			errorOps: []string{"PostSync"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Remove(marker)
+			synced := false
+			report, err := withHooks(context.Background(), test.hooks, func() (synchronizer.SyncReport, error) {
+				synced = true
+				return synchronizer.SyncReport{State: synchronizer.ReportComplete, Errors: []synchronizer.PathError{}}, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if synced != test.synced {
+				t.Fatalf("synced %t, expected %t", synced, test.synced)
+			}
+			if aborted := report.State == synchronizer.ReportAborted; aborted != test.aborted {
+				t.Fatalf("aborted %t, expected %t", aborted, test.aborted)
+			}
+			if len(report.Errors) != len(test.errorOps) {
+				t.Fatalf("errors %v, expected ops %v", report.Errors, test.errorOps)
+			}
+			for i, op := range test.errorOps {
+				if report.Errors[i].Op != op {
+					t.Fatalf("errors %v, expected ops %v", report.Errors, test.errorOps)
+				}
+			}
+			if _, err := os.Stat(marker); (err == nil) != test.markerSet {
+				t.Fatalf("marker set %t, expected %t", err == nil, test.markerSet)
+			}
+		})
+	}
+}
+
+func TestUploadHook(t *testing.T) {
+	file := synchronizer.UploadedFile{Path: "/a", Size: 3, HashMd5: "m"}
+	tests := []struct {
+		name    string
+		hooks   []Hook
+		wantErr bool
+	}{
+		{"no hooks", nil, false},
+		{"environment", []Hook{{Command: []string{"sh", "-c", `test "$DAVSYNC_PATH/$DAVSYNC_SIZE/$DAVSYNC_MD5" = /a/3/m`}, Strict: true}}, false},
+		{"failed strict", []Hook{{Command: []string{"false"}, Strict: true}}, true},
+		{"failed", []Hook{{Command: []string{"false"}}}, false},
+	}
+	for _, test := range tests {
+		err := uploadHook(context.Background(), test.hooks)(file)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error %v, expected error %t", test.name, err, test.wantErr)
+		}
+	}
+}
@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
 
 	"github.com/io-developer/go-davsync/pkg/client"
 	"github.com/io-developer/go-davsync/pkg/client/local"
 	"github.com/io-developer/go-davsync/pkg/client/webdav"
 	"github.com/io-developer/go-davsync/pkg/client/yadisk"
 	"github.com/io-developer/go-davsync/pkg/client/yadiskrest"
+	"github.com/io-developer/go-davsync/pkg/filter"
 	"github.com/io-developer/go-davsync/pkg/log"
 	"github.com/io-developer/go-davsync/pkg/synchronizer"
+	"github.com/io-developer/go-davsync/pkg/watch"
 )
 
 // ClientConfig of input/output
@@ -34,8 +44,22 @@ const (
 
 // SyncConfig of sync
 type SyncConfig struct {
-	Type   SyncType
-	OneWay synchronizer.OneWayOpt
+	Type       SyncType
+	DryRun     bool
+	Resume     bool
+	Snapshot   bool
+	Watch      bool
+	WatchOpt   synchronizer.WatchOpt
+	WatchPoll  time.Duration
+	PlanFormat PlanFormat
+	Filter     filter.Options
+
+	// BandwidthLimit like "2M" or "08:00-19:00 2M, otherwise unlimited"
+	BandwidthLimit string
+	OneWay         synchronizer.OneWayOpt
+	TwoWay         synchronizer.TwoWayOpt
+	SnapshotOpt    synchronizer.SnapshotOpt
+	Hooks          Hooks
 }
 
 // SyncType ..
@@ -44,31 +68,109 @@ type SyncType string
 // Sync types
 const (
 	SyncTypeOneWay = SyncType("OneWay")
+	SyncTypeTwoWay = SyncType("TwoWay")
+)
+
+// PlanFormat of dry-run output
+type PlanFormat string
+
+// Plan formats
+const (
+	PlanFormatText = PlanFormat("text")
+	PlanFormatJSON = PlanFormat("json")
+)
+
+// Exit codes
+const (
+	ExitOK      = 0
+	ExitConfig  = 2
+	ExitPartial = 3
+	ExitFailure = 4
 )
 
+// fail logs error and returns exit code
+func fail(code int, a ...interface{}) int {
+	log.Error(a...)
+	return code
+}
+
+// main exits only here, after deferred cleanups of run
 func main() {
 	log.DefaultLogger.SetLevel(log.InfoLevel)
+	os.Exit(run())
+}
+
+func run() int {
+	if len(os.Args) > 1 && os.Args[1] == "daemon" {
+		return runDaemon(os.Args[2:])
+	}
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		return runVerify(os.Args[2:])
+	}
 
-	args, err := parseArgs()
+	args, err := parseArgs(flag.CommandLine, os.Args[1:])
 	if err != nil {
-		log.Fatal("Error at cli args parsing", err)
+		return fail(ExitConfig, "Error at cli args parsing", err)
 	}
 	log.Debugf("CLI ARGS:\n%#v\n\n", args)
 
+	if args.syncConfig.DryRun && args.syncConfig.PlanFormat == PlanFormatJSON {
+		// keep stdout clean for JSON plan, warnings and errors go to stderr
+		log.DefaultLogger.SetLevel(log.WarnLevel)
+	}
+
 	input, err := createClient(args.inputConfig)
 	if err != nil {
-		log.Fatal("Input client creation error", err)
+		return fail(ExitConfig, "Input client creation error", err)
 	}
+	defer closeClient(input)
 	output, err := createClient(args.outputConfig)
 	if err != nil {
-		log.Fatal("Output client creation error", err)
+		return fail(ExitConfig, "Output client creation error", err)
+	}
+	defer closeClient(output)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if args.syncConfig.DryRun {
+		err = plan(ctx, input, output, args.syncConfig)
+		if err != nil {
+			return fail(ExitFailure, "Plan error", err)
+		}
+		return ExitOK
+	}
+
+	var watcher watch.Watcher
+	if args.syncConfig.Watch {
+		watcher, err = createWatcher(args.inputConfig, args.syncConfig)
+		if err != nil {
+			return fail(ExitConfig, "Watcher creation error", err)
+		}
+		defer watcher.Close()
+	}
+
+	track := func(s stopper) func() {
+		return watchSignals(s, cancel)
 	}
-	err = sync(input, output, args.syncConfig)
+	report, err := runSync(ctx, input, output, args.outputConfig, args.syncConfig, watcher, track)
 	if err != nil {
-		log.Fatal("Sync error", err)
+		return fail(ExitFailure, "Sync error", err)
+	}
+	if args.reportPath != "" {
+		err = writeReport(args.reportPath, report)
+		if err != nil {
+			log.Error("Report writing error", err)
+		}
 	}
 
+	switch report.Status() {
+	case synchronizer.ReportPartial:
+		return fail(ExitPartial, "Sync partially failed")
+	case synchronizer.ReportFailure:
+		return fail(ExitFailure, "Sync failed")
+	}
 	log.Info("\n\nDone.")
+	return ExitOK
 }
 
 func createClient(conf ClientConfig) (c client.Client, err error) {
@@ -93,36 +195,221 @@ func createClient(conf ClientConfig) (c client.Client, err error) {
 	return
 }
 
-func sync(input, output client.Client, conf SyncConfig) error {
+// closeClient flushes state of client, errors are only logged
+func closeClient(c client.Client) {
+	if err := client.Close(c); err != nil {
+		log.Warn("Client closing error", err)
+	}
+}
+
+// subClientFn creates clients rooted at subdirs of base dir of conf
+func subClientFn(conf ClientConfig) synchronizer.SubClientFn {
+	return func(dir string) (client.Client, error) {
+		subConf := conf
+		subConf.BaseDir = path.Join(conf.BaseDir, dir)
+		subConf.LocalOptions.BaseDir = filepath.Join(conf.LocalOptions.BaseDir, dir)
+		subConf.WebdavOptions.BaseDir = path.Join(conf.WebdavOptions.BaseDir, dir)
+		subConf.YadiskRestOptions.BaseDir = path.Join(conf.YadiskRestOptions.BaseDir, dir)
+		return createClient(subConf)
+	}
+}
+
+// createWatcher prefers filesystem notifications, polls ReadTree of separate
+// client otherwise
+func createWatcher(conf ClientConfig, syncConf SyncConfig) (watch.Watcher, error) {
+	if syncConf.Type != SyncTypeOneWay {
+		return nil, fmt.Errorf("Watch is not supported by sync-type '%s'", syncConf.Type)
+	}
+	if conf.Type == ClientTypeLocal && syncConf.WatchPoll == 0 {
+		watcher, err := watch.NewNotifier(conf.LocalOptions.BaseDir)
+		if err == nil {
+			log.Info("Watching input with filesystem notifications")
+			return watcher, nil
+		}
+		log.Warn("Filesystem notifications unavailable, polling", err)
+	}
+	interval := syncConf.WatchPoll
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	// polling compares size and mtime only, hashing is left to sync
+	conf.LocalOptions.HashCache = ""
+	c, err := createClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	log.Info(fmt.Sprintf("Watching input by polling every %s", interval))
+	return watch.NewPoller(c, interval), nil
+}
+
+// syncTracker gets running synchronizer, returned func is called when it is done
+type syncTracker func(s stopper) (release func())
+
+func runSync(
+	ctx context.Context,
+	input, output client.Client,
+	outputConf ClientConfig,
+	conf SyncConfig,
+	watcher watch.Watcher,
+	track syncTracker,
+) (synchronizer.SyncReport, error) {
+	if len(conf.Hooks.PostUpload) > 0 {
+		conf.OneWay.UploadHook = uploadHook(ctx, conf.Hooks.PostUpload)
+	}
+	return withHooks(ctx, conf.Hooks, func() (synchronizer.SyncReport, error) {
+		return dispatchSync(ctx, input, output, outputConf, conf, watcher, track)
+	})
+}
+
+func dispatchSync(
+	ctx context.Context,
+	input, output client.Client,
+	outputConf ClientConfig,
+	conf SyncConfig,
+	watcher watch.Watcher,
+	track syncTracker,
+) (synchronizer.SyncReport, error) {
+	if conf.Type == SyncTypeOneWay && conf.Snapshot {
+		return syncSnapshot(ctx, input, output, outputConf, conf, track), nil
+	}
 	if conf.Type == SyncTypeOneWay {
-		return syncOnewWay(input, output, conf)
+		return syncOnewWay(ctx, input, output, conf, watcher, track), nil
+	}
+	if conf.Type == SyncTypeTwoWay {
+		return syncTwoWay(ctx, input, output, conf, track), nil
 	}
-	return fmt.Errorf("Unexpected sync-type '%s'", string(conf.Type))
+	return synchronizer.SyncReport{}, fmt.Errorf("Unexpected sync-type '%s'", string(conf.Type))
 }
 
-func syncOnewWay(input, output client.Client, conf SyncConfig) error {
+func plan(ctx context.Context, input, output client.Client, conf SyncConfig) error {
+	if conf.Type != SyncTypeOneWay {
+		return fmt.Errorf("Dry-run is not supported by sync-type '%s'", conf.Type)
+	}
+	s := synchronizer.NewOneWay(input, output, conf.OneWay)
+	errors := make(chan error)
+	go logErrors(errors)
+
+	plan := s.Plan(ctx, errors)
+	if err := s.CheckDeletes(plan); err != nil {
+		log.Warn("Sync would be refused:", err)
+	}
+	close(errors)
+	if err := printPlan(plan, conf.PlanFormat); err != nil {
+		return err
+	}
+	if !s.TreesRead() {
+		return fmt.Errorf("Trees could not be read, the plan is incomplete")
+	}
+	return nil
+}
+
+func syncOnewWay(
+	ctx context.Context,
+	input, output client.Client,
+	conf SyncConfig,
+	watcher watch.Watcher,
+	track syncTracker,
+) synchronizer.SyncReport {
 	log.Debug("Sync OneWay start..")
 
 	s := synchronizer.NewOneWay(input, output, conf.OneWay)
+	release := track(s)
+	defer release()
 
 	errors := make(chan error)
-	go func(errors <-chan error) {
-		log.Info("Listening for errors...")
-		for {
-			select {
-			case err, ok := <-errors:
-				if !ok {
-					return
-				}
-				log.Error("!!! ERROR", err)
-			}
-		}
-	}(errors)
+	go logErrors(errors)
 
-	s.Sync(errors)
+	var report synchronizer.SyncReport
+	if watcher != nil {
+		report = s.Watch(ctx, watcher, conf.WatchOpt, errors)
+	} else if conf.Resume {
+		report = s.Resume(ctx, errors)
+	} else {
+		report = s.Sync(ctx, errors)
+	}
 	close(errors)
 
 	log.Debug("Sync OneWay end")
 
-	return nil
+	return report
+}
+
+func syncSnapshot(
+	ctx context.Context,
+	input, output client.Client,
+	outputConf ClientConfig,
+	conf SyncConfig,
+	track syncTracker,
+) synchronizer.SyncReport {
+	log.Debug("Sync Snapshot start..")
+
+	s := synchronizer.NewSnapshot(input, output, subClientFn(outputConf), conf.SnapshotOpt, conf.OneWay)
+	release := track(s)
+	defer release()
+
+	errors := make(chan error)
+	go logErrors(errors)
+
+	report := s.Sync(ctx, errors)
+	close(errors)
+
+	log.Debug("Sync Snapshot end")
+
+	return report
+}
+
+func syncTwoWay(ctx context.Context, input, output client.Client, conf SyncConfig, track syncTracker) synchronizer.SyncReport {
+	log.Debug("Sync TwoWay start..")
+
+	if conf.Resume {
+		log.Warn("Resume is not supported by TwoWay sync, it relies on its state instead")
+	}
+
+	s := synchronizer.NewTwoWay(input, output, conf.TwoWay, conf.OneWay)
+	release := track(s)
+	defer release()
+
+	errors := make(chan error)
+	go logErrors(errors)
+
+	report := s.Sync(ctx, errors)
+	close(errors)
+
+	log.Debug("Sync TwoWay end")
+
+	return report
+}
+
+func logErrors(errors <-chan error) {
+	for err := range errors {
+		log.Error("!!! ERROR", err)
+	}
+}
+
+func writeReport(path string, report synchronizer.SyncReport) error {
+	bytes, err := reportJSON(report)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bytes, 0644)
+}
+
+func reportJSON(report synchronizer.SyncReport) ([]byte, error) {
+	return json.MarshalIndent(struct {
+		synchronizer.SyncReport
+		Status synchronizer.ReportStatus
+	}{report, report.Status()}, "", "  ")
+}
+
+func printPlan(plan synchronizer.Plan, format PlanFormat) error {
+	if format == PlanFormatJSON {
+		bytes, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Println(string(bytes))
+		return err
+	}
+	fmt.Println("\nPlan:")
+	return plan.WriteText(os.Stdout)
 }
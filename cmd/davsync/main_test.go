@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/io-developer/go-davsync/pkg/client/local"
+)
+
+func TestPlanFailsOnUnreadableTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "readable", input: dir},
+		{name: "missing input", input: filepath.Join(dir, "missing"), wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			input := local.NewClient(local.Options{BaseDir: test.input})
+			output := local.NewClient(local.Options{BaseDir: dir})
+			conf := SyncConfig{Type: SyncTypeOneWay, PlanFormat: PlanFormatJSON}
+			err := plan(context.Background(), input, output, conf)
+			if test.wantErr && err == nil {
+				t.Fatal("expected error")
+			}
+			if !test.wantErr && err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
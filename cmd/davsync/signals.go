@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/io-developer/go-davsync/pkg/log"
+)
+
+type stopper interface {
+	Stop()
+}
+
+// watchSignals stops gracefully on the first signal and aborts on the second.
+// Call returned func when sync is over
+func watchSignals(s stopper, cancel context.CancelFunc) (release func()) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	done := make(chan struct{})
+
+	go func() {
+		select {
+		case sig := <-signals:
+			log.Warn("Signal", sig, "received: finishing in-flight files, no new ones will start. Send it again to abort immediately")
+			s.Stop()
+		case <-done:
+			return
+		}
+		select {
+		case sig := <-signals:
+			log.Warn("Signal", sig, "received again: aborting")
+			cancel()
+		case <-done:
+			return
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(done)
+	}
+}
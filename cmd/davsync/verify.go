@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+
+	"github.com/io-developer/go-davsync/pkg/log"
+	"github.com/io-developer/go-davsync/pkg/synchronizer"
+)
+
+// Exit code of verify finding differences
+const ExitDiffers = 1
+
+func runVerify(arguments []string) int {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	download := flags.Bool("download", false, "Download and hash output files exposing no comparable checksum, like ETag-only ones")
+	args, err := parseArgs(flags, arguments)
+	if err != nil {
+		return fail(ExitConfig, "Error at cli args parsing", err)
+	}
+
+	input, err := createClient(args.inputConfig)
+	if err != nil {
+		return fail(ExitConfig, "Input client creation error", err)
+	}
+	defer closeClient(input)
+	output, err := createClient(args.outputConfig)
+	if err != nil {
+		return fail(ExitConfig, "Output client creation error", err)
+	}
+	defer closeClient(output)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	v := synchronizer.NewVerifier(input, output, synchronizer.VerifyOpt{
+		Download:    *download,
+		ThreadCount: args.syncConfig.OneWay.ThreadCount,
+		Filter:      args.syncConfig.OneWay.Filter,
+		Limiter:     args.syncConfig.OneWay.Limiter,
+	})
+	release := watchSignals(v, cancel)
+	errors := make(chan error)
+	go logErrors(errors)
+	report := v.Verify(ctx, errors)
+	close(errors)
+	release()
+
+	if args.reportPath != "" {
+		err = writeVerifyReport(args.reportPath, report)
+		if err != nil {
+			log.Error("Report writing error", err)
+		}
+	}
+
+	switch {
+	case report.State == synchronizer.ReportAborted && report.InputFiles == 0 && report.OutputFiles == 0:
+		return fail(ExitFailure, "Verify failed")
+	case report.Count(synchronizer.VerifyError) > 0:
+		return fail(ExitFailure, "Some files could not be verified")
+	case report.HasDifferences():
+		return fail(ExitDiffers, "Output differs from input")
+	case report.State != synchronizer.ReportComplete:
+		return fail(ExitPartial, "Verify was stopped")
+	}
+	log.Info("\n\nDone.")
+	return ExitOK
+}
+
+func writeVerifyReport(path string, report synchronizer.VerifyReport) error {
+	bytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, bytes, 0644)
+}
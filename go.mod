@@ -1,3 +1,7 @@
 module github.com/io-developer/go-davsync
 
-go 1.13
+go 1.17
+
+require github.com/fsnotify/fsnotify v1.8.0
+
+require golang.org/x/sys v0.13.0 // indirect
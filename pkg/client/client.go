@@ -1,6 +1,14 @@
 package client
 
-import "io"
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotSupported is returned by optional capabilities the backend lacks
+var ErrNotSupported = errors.New("Operation is not supported by backend")
 
 type Client interface {
 	ToAbsPath(relPath string) string
@@ -15,5 +23,67 @@ type Client interface {
 	ReadFile(path string) (reader io.ReadCloser, err error)
 	WriteFile(path string, content io.ReadCloser, size int64) error
 	MoveFile(srcPath, dstPath string) error
+	// CopyFile copies file or whole dir on the same side
+	CopyFile(srcPath, dstPath string) error
 	DeleteFile(path string) error
+	DeleteDir(path string) error
+}
+
+// Filter decides whether tree resource takes part in sync
+type Filter interface {
+	Match(path string, res Resource) bool
+}
+
+// IgnoreCounter is implemented by clients honouring per-dir ignore files
+type IgnoreCounter interface {
+	IgnoredCount() int
+}
+
+// Ignorer is implemented by clients able to tell ignored paths without ReadTree
+type Ignorer interface {
+	IsIgnored(path string, isDir bool) bool
+}
+
+// DirReader is implemented by clients able to list a single dir without ReadTree.
+// Children are keyed by relative path, missing dir gives no children
+type DirReader interface {
+	ReadDir(path string) (children map[string]Resource, err error)
+}
+
+// ModTimeSetter is implemented by clients able to keep source mtime of written files
+type ModTimeSetter interface {
+	SetModTime(path string, modTime time.Time) error
+}
+
+// Hasher is implemented by clients filling hashes of file cheaper than by reading it
+type Hasher interface {
+	Hash(path string, res Resource) (Resource, error)
+}
+
+// Closer is implemented by clients keeping state to flush after sync
+type Closer interface {
+	Close() error
+}
+
+// Close flushes state of client if supported
+func Close(c Client) error {
+	if closer, ok := c.(Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// ContextBinder is implemented by clients able to abort requests.
+// The client itself is left as is, so it may be shared by syncs
+type ContextBinder interface {
+	WithContext(ctx context.Context) Client
+}
+
+// WithContext returns a copy of client with requests bound to context
+// if supported, the client itself otherwise
+func WithContext(c Client, ctx context.Context) Client {
+	if binder, ok := c.(ContextBinder); ok {
+		return binder.WithContext(ctx)
+	}
+	return c
 }
@@ -2,8 +2,11 @@ package local
 
 import (
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/io-developer/go-davsync/pkg/client"
 	"github.com/io-developer/go-davsync/pkg/util"
@@ -12,13 +15,20 @@ import (
 type Client struct {
 	client.Client
 
-	opt Options
+	opt          Options
+	ignore       *ignoreRules
+	ignoredCount int
+	hashes       *hashCache
 }
 
 func NewClient(opt Options) *Client {
-	return &Client{
+	c := &Client{
 		opt: opt,
 	}
+	if opt.HashCache != "" {
+		c.hashes = newHashCache(opt.HashCache, opt.HashWorkers)
+	}
+	return c
 }
 
 func (c *Client) ToAbsPath(relPath string) string {
@@ -32,15 +42,80 @@ func (c *Client) ToRelativePath(absPath string) string {
 func (c *Client) ReadTree() (parents map[string]client.Resource, children map[string]client.Resource, err error) {
 	parents = map[string]client.Resource{}
 	children = map[string]client.Resource{}
+	c.ignoredCount = 0
+	ignore := newIgnoreRules(c.opt.IgnoreFile)
+	c.ignore = ignore
+	if c.hashes != nil {
+		err = c.hashes.load()
+		if err != nil {
+			return
+		}
+		c.hashes.startTree()
+	}
 	err = filepath.Walk(c.opt.BaseDir, func(absPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
 		res := c.toResource(absPath, info)
 		path := res.Path
+		if c.opt.IgnoreFile != "" && ignore.isIgnored(path, res.IsDir) {
+			c.ignoredCount++
+			if res.IsDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if c.hashes != nil && !res.IsDir && res.HashSha256 == "" {
+			c.hashes.refresh(res.AbsPath, info)
+		}
 		children[path] = res
+		if res.IsDir && c.opt.IgnoreFile != "" {
+			ignore.load(path, absPath)
+		}
 		return nil
 	})
 	return
 }
 
+// IsIgnored checks path and its parents against ignore files found on last ReadTree
+func (c *Client) IsIgnored(path string, isDir bool) bool {
+	if c.ignore == nil || c.opt.IgnoreFile == "" {
+		return false
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	dir := "/"
+	for _, part := range parts[:len(parts)-1] {
+		dir += part + "/"
+		if c.ignore.isIgnored(dir, true) {
+			return true
+		}
+	}
+	return c.ignore.isIgnored(path, isDir)
+}
+
+// IgnoredCount is a number of files and pruned dirs left out by ignore files
+// on last ReadTree
+func (c *Client) IgnoredCount() int {
+	return c.ignoredCount
+}
+
+func (c *Client) ReadDir(path string) (children map[string]client.Resource, err error) {
+	children = map[string]client.Resource{}
+	absDir := c.opt.toAbsPath(path)
+	infos, err := ioutil.ReadDir(absDir)
+	if os.IsNotExist(err) {
+		return children, nil
+	}
+	if err != nil {
+		return
+	}
+	for _, info := range infos {
+		res := c.toResource(filepath.Join(absDir, info.Name()), info)
+		children[res.Path] = res
+	}
+	return
+}
+
 func (c *Client) ReadResource(path string) (res client.Resource, exists bool, err error) {
 	absPath := c.opt.toAbsPath(path)
 	info, err := os.Stat(absPath)
@@ -49,7 +124,7 @@ func (c *Client) ReadResource(path string) (res client.Resource, exists bool, er
 		exists = true
 		return
 	}
-	if err == os.ErrNotExist {
+	if os.IsNotExist(err) {
 		err = nil
 	}
 	return
@@ -70,10 +145,11 @@ func (c *Client) ReadFile(path string) (reader io.ReadCloser, err error) {
 
 func (c *Client) WriteFile(path string, content io.ReadCloser, size int64) error {
 	absPath := c.opt.toAbsPath(path)
-	file, err := os.OpenFile(absPath, os.O_CREATE|os.O_WRONLY, c.opt.FileMode)
+	file, err := os.OpenFile(absPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, c.opt.FileMode)
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 	_, err = io.Copy(file, content)
 	if err != nil {
 		return err
@@ -85,13 +161,92 @@ func (c *Client) MoveFile(srcPath, dstPath string) error {
 	return os.Rename(c.opt.toAbsPath(srcPath), c.opt.toAbsPath(dstPath))
 }
 
+func (c *Client) CopyFile(srcPath, dstPath string) error {
+	absSrc := strings.TrimRight(c.opt.toAbsPath(srcPath), "/")
+	absDst := strings.TrimRight(c.opt.toAbsPath(dstPath), "/")
+	return filepath.Walk(absSrc, func(absPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		target := absDst + strings.TrimPrefix(absPath, absSrc)
+		if info.IsDir() {
+			err = os.MkdirAll(target, c.opt.DirMode)
+		} else {
+			err = copyLocalFile(absPath, target, c.opt.FileMode)
+		}
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+}
+
+func copyLocalFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Hash fills hashes of file from cache or by reading it
+func (c *Client) Hash(path string, res client.Resource) (client.Resource, error) {
+	absPath := util.PathNormalize(c.opt.toAbsPath(path), false)
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return res, err
+	}
+	var entry hashEntry
+	if c.hashes != nil {
+		err = c.hashes.load()
+		if err == nil {
+			entry, err = c.hashes.get(absPath, info)
+		}
+	} else {
+		entry, err = hashFile(absPath, info)
+	}
+	if err != nil {
+		return res, err
+	}
+	res.HashMd5 = entry.Md5
+	res.HashSha256 = entry.Sha256
+	return res, nil
+}
+
+// Close waits for background hashing and compacts hash cache
+func (c *Client) Close() error {
+	if c.hashes == nil {
+		return nil
+	}
+	return c.hashes.close()
+}
+
+func (c *Client) SetModTime(path string, modTime time.Time) error {
+	return os.Chtimes(c.opt.toAbsPath(path), modTime, modTime)
+}
+
 func (c *Client) DeleteFile(path string) error {
 	return os.Remove(c.opt.toAbsPath(path))
 }
 
+func (c *Client) DeleteDir(path string) error {
+	// os.Remove refuses to delete non-empty dirs
+	return os.Remove(c.opt.toAbsPath(path))
+}
+
 func (c *Client) toResource(absPath string, info os.FileInfo) client.Resource {
 	absPath = util.PathNormalize(absPath, info.IsDir())
-	return client.Resource{
+	res := client.Resource{
 		AbsPath:  absPath,
 		Path:     c.opt.toRelPath(absPath),
 		Name:     info.Name(),
@@ -100,4 +255,11 @@ func (c *Client) toResource(absPath string, info os.FileInfo) client.Resource {
 		ModTime:  info.ModTime(),
 		UserData: info,
 	}
+	if c.hashes != nil && !res.IsDir {
+		if entry, ok := c.hashes.lookup(absPath, info); ok {
+			res.HashMd5 = entry.Md5
+			res.HashSha256 = entry.Sha256
+		}
+	}
+	return res
 }
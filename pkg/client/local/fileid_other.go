@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package local
+
+import (
+	"os"
+)
+
+// fileKey identifies file by path where inodes are not available
+func fileKey(absPath string, info os.FileInfo) string {
+	return absPath
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package local
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileKey identifies file by device and inode, so renamed files keep their hashes
+func fileKey(absPath string, info os.FileInfo) string {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fmt.Sprintf("%d:%d", uint64(stat.Dev), uint64(stat.Ino))
+	}
+	return absPath
+}
@@ -0,0 +1,333 @@
+package local
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/io-developer/go-davsync/pkg/log"
+	"github.com/io-developer/go-davsync/pkg/util"
+)
+
+// hashEntry is file hashes valid while size and mtime are the same
+type hashEntry struct {
+	Size    int64
+	ModTime int64
+	Md5     string
+	Sha256  string
+}
+
+func (e hashEntry) isFresh(info os.FileInfo) bool {
+	return e.Size == info.Size() && e.ModTime == info.ModTime().UnixNano()
+}
+
+// hashRecord is a line of cache file, later lines override earlier ones
+type hashRecord struct {
+	Key string
+	hashEntry
+}
+
+type hashJob struct {
+	absPath string
+	info    os.FileInfo
+	started bool
+	done    chan struct{}
+	entry   hashEntry
+	err     error
+}
+
+// hashCache keeps file hashes in a local append-only file keyed by device
+// and inode. Stale entries are rehashed in background by a bounded worker pool
+type hashCache struct {
+	path       string
+	maxWorkers int
+
+	mu       sync.Mutex
+	loaded   bool
+	treeRead bool
+	entries  map[string]hashEntry
+	seen     map[string]bool
+	jobs     map[string]*hashJob
+	queue    []*hashJob
+	workers  int
+	running  sync.WaitGroup
+
+	fileMu sync.Mutex
+	file   *os.File
+	lines  int
+}
+
+func newHashCache(path string, workers int) *hashCache {
+	if workers < 1 {
+		workers = 1
+	}
+	return &hashCache{
+		path:       path,
+		maxWorkers: workers,
+		entries:    map[string]hashEntry{},
+		seen:       map[string]bool{},
+		jobs:       map[string]*hashJob{},
+	}
+}
+
+func (h *hashCache) load() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.loaded {
+		return nil
+	}
+	file, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		h.loaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		rec := hashRecord{}
+		// last line may be cut by crash
+		if json.Unmarshal(scanner.Bytes(), &rec) != nil || rec.Key == "" {
+			continue
+		}
+		h.entries[rec.Key] = rec.hashEntry
+		lines++
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("Hash cache '%s' is broken, delete it to start over: %v", h.path, err)
+	}
+	h.lines = lines
+	h.loaded = true
+	return nil
+}
+
+// startTree forgets files seen by previous tree read
+func (h *hashCache) startTree() {
+	h.mu.Lock()
+	h.seen = map[string]bool{}
+	h.treeRead = true
+	h.mu.Unlock()
+}
+
+// lookup returns fresh entry of file
+func (h *hashCache) lookup(absPath string, info os.FileInfo) (entry hashEntry, ok bool) {
+	key := fileKey(absPath, info)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seen[key] = true
+	entry, ok = h.entries[key]
+	return entry, ok && entry.isFresh(info)
+}
+
+// refresh queues stale file for background hashing
+func (h *hashCache) refresh(absPath string, info os.FileInfo) {
+	key := fileKey(absPath, info)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, queued := h.jobs[key]; queued {
+		return
+	}
+	job := &hashJob{
+		absPath: absPath,
+		info:    info,
+		done:    make(chan struct{}),
+	}
+	h.jobs[key] = job
+	h.queue = append(h.queue, job)
+	for h.workers < h.maxWorkers && h.workers < len(h.queue) {
+		h.workers++
+		h.running.Add(1)
+		go h.work()
+	}
+}
+
+func (h *hashCache) work() {
+	for {
+		h.mu.Lock()
+		var job *hashJob
+		for job == nil && len(h.queue) > 0 {
+			job = h.queue[0]
+			h.queue = h.queue[1:]
+			if job.started {
+				job = nil
+			}
+		}
+		if job == nil {
+			h.workers--
+			h.mu.Unlock()
+			h.running.Done()
+			return
+		}
+		job.started = true
+		h.mu.Unlock()
+
+		h.run(job)
+	}
+}
+
+// get returns hashes of file, hashing it now unless a worker already does
+func (h *hashCache) get(absPath string, info os.FileInfo) (hashEntry, error) {
+	if entry, ok := h.lookup(absPath, info); ok {
+		return entry, nil
+	}
+	key := fileKey(absPath, info)
+	h.mu.Lock()
+	job, queued := h.jobs[key]
+	if queued && job.started {
+		h.mu.Unlock()
+		<-job.done
+		return job.entry, job.err
+	}
+	if !queued {
+		job = &hashJob{
+			absPath: absPath,
+			info:    info,
+			done:    make(chan struct{}),
+		}
+		h.jobs[key] = job
+	}
+	job.started = true
+	h.mu.Unlock()
+
+	h.run(job)
+	return job.entry, job.err
+}
+
+func (h *hashCache) run(job *hashJob) {
+	job.entry, job.err = hashFile(job.absPath, job.info)
+	if job.err != nil {
+		log.Debug("Hash cache: hashing error", job.err)
+	}
+	key := fileKey(job.absPath, job.info)
+
+	h.mu.Lock()
+	delete(h.jobs, key)
+	if job.err == nil {
+		h.entries[key] = job.entry
+		h.seen[key] = true
+	}
+	h.mu.Unlock()
+	close(job.done)
+
+	if job.err == nil {
+		h.append(key, job.entry)
+	}
+}
+
+// append writes entry to the end of cache file, so nothing is lost on exit
+func (h *hashCache) append(key string, entry hashEntry) {
+	h.fileMu.Lock()
+	defer h.fileMu.Unlock()
+	bytes, err := json.Marshal(hashRecord{Key: key, hashEntry: entry})
+	if err == nil && h.file == nil {
+		h.file, err = os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	}
+	if err == nil {
+		_, err = h.file.Write(append(bytes, '\n'))
+	}
+	if err != nil {
+		log.Warn("Hash cache writing error", h.path, err)
+		return
+	}
+	h.lines++
+}
+
+// close drops queued hashing, waits for running one and compacts cache file
+// to entries of files seen by the last tree read or hashed since
+func (h *hashCache) close() error {
+	h.mu.Lock()
+	for _, job := range h.queue {
+		if !job.started {
+			delete(h.jobs, fileKey(job.absPath, job.info))
+		}
+	}
+	h.queue = nil
+	h.mu.Unlock()
+	h.running.Wait()
+
+	h.fileMu.Lock()
+	defer h.fileMu.Unlock()
+	var err error
+	if h.file != nil {
+		err = h.file.Close()
+		h.file = nil
+	}
+	h.mu.Lock()
+	if !h.loaded {
+		h.mu.Unlock()
+		return err
+	}
+	records := []hashRecord{}
+	for key, entry := range h.entries {
+		if h.seen[key] || !h.treeRead {
+			records = append(records, hashRecord{Key: key, hashEntry: entry})
+		}
+	}
+	h.mu.Unlock()
+	if len(records) == h.lines {
+		return err
+	}
+
+	tmpPath := h.path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, rec := range records {
+		if err = encoder.Encode(rec); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, h.path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("Hash cache '%s' compacting error: %v", h.path, err)
+	}
+	h.lines = len(records)
+	return nil
+}
+
+// hashFile reads file and fails if it was changed meanwhile
+func hashFile(absPath string, info os.FileInfo) (entry hashEntry, err error) {
+	file, err := os.Open(absPath)
+	if err != nil {
+		return
+	}
+	reader := util.NewRead(file, info.Size())
+	defer reader.Close()
+	_, err = io.Copy(ioutil.Discard, reader)
+	if err != nil && !util.ErrorIsEOF(err) {
+		return
+	}
+	after, err := os.Stat(absPath)
+	if err != nil {
+		return
+	}
+	entry = hashEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Md5:     reader.GetHashMd5(),
+		Sha256:  reader.GetHashSha256(),
+	}
+	if !entry.isFresh(after) || reader.GetBytesRead() != info.Size() {
+		err = fmt.Errorf("File changed while hashing, %s", absPath)
+	}
+	return
+}
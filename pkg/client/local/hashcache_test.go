@@ -0,0 +1,115 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, dir string, contents map[string]string) map[string]os.FileInfo {
+	infos := map[string]os.FileInfo{}
+	for name, content := range contents {
+		absPath := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(absPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(absPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		infos[absPath] = info
+	}
+	return infos
+}
+
+func countLines(t *testing.T, path string) int {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(bytes), "\n")
+}
+
+func TestHashCacheAppendAndCompact(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hashcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cachePath := filepath.Join(dir, "cache.jsonl")
+	infos := writeTestFiles(t, dir, map[string]string{"a": "aaa", "b": "bbbb"})
+
+	h := newHashCache(cachePath, 2)
+	if err := h.load(); err != nil {
+		t.Fatal(err)
+	}
+	for absPath, info := range infos {
+		if _, err := h.get(absPath, info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// written without close, as if killed
+	if lines := countLines(t, cachePath); lines != 2 {
+		t.Fatalf("%d lines appended, expected 2", lines)
+	}
+
+	file, err := os.OpenFile(cachePath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"Key":"cut","Si`)
+	file.Close()
+
+	h = newHashCache(cachePath, 2)
+	if err := h.load(); err != nil {
+		t.Fatal(err)
+	}
+	h.startTree()
+	if len(h.entries) != 2 {
+		t.Fatalf("%d entries after reload, expected 2", len(h.entries))
+	}
+	// only a is seen by the tree read
+	absPath := filepath.Join(dir, "a")
+	if entry, ok := h.lookup(absPath, infos[absPath]); !ok || entry.Sha256 == "" {
+		t.Fatalf("%s: no fresh entry after reload", absPath)
+	}
+	if err := h.close(); err != nil {
+		t.Fatal(err)
+	}
+	if lines := countLines(t, cachePath); lines != 1 {
+		t.Fatalf("%d lines after compact, expected 1 seen file", lines)
+	}
+}
+
+func TestHashCacheCloseWaitsForWorkers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hashcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cachePath := filepath.Join(dir, "cache.jsonl")
+	infos := writeTestFiles(t, dir, map[string]string{"a": "1", "b": "22", "c": "333", "d": "4444"})
+
+	h := newHashCache(cachePath, 1)
+	if err := h.load(); err != nil {
+		t.Fatal(err)
+	}
+	for absPath, info := range infos {
+		h.refresh(absPath, info)
+	}
+	if err := h.close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.jobs) != 0 || len(h.queue) != 0 || h.workers != 0 {
+		t.Fatalf("jobs left after close: %d jobs, %d queued, %d workers", len(h.jobs), len(h.queue), h.workers)
+	}
+	h = newHashCache(cachePath, 1)
+	if err := h.load(); err != nil {
+		t.Fatal(err)
+	}
+	if h.lines != len(h.entries) {
+		t.Fatalf("%d lines of %d entries after close", h.lines, len(h.entries))
+	}
+}
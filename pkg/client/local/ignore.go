@@ -0,0 +1,62 @@
+package local
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/io-developer/go-davsync/pkg/filter"
+	"github.com/io-developer/go-davsync/pkg/log"
+)
+
+// ignoreRules holds rules of ignore files by relative dir path.
+// Patterns of a file are relative to its dir, like .gitignore
+type ignoreRules struct {
+	fileName string
+	dirs     map[string]*filter.Filter
+}
+
+func newIgnoreRules(fileName string) *ignoreRules {
+	return &ignoreRules{
+		fileName: fileName,
+		dirs:     map[string]*filter.Filter{},
+	}
+}
+
+// load reads ignore file of dir if exists
+func (r *ignoreRules) load(dirPath, absDir string) {
+	rules, err := filter.ParseRulesFile(filepath.Join(absDir, r.fileName))
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Warn("Ignore file reading error", dirPath, err)
+		return
+	}
+	f, err := filter.New(filter.Options{Rules: rules})
+	if err != nil {
+		log.Warn("Ignore file parsing error", dirPath, err)
+		return
+	}
+	r.dirs[dirPath] = f
+}
+
+// isIgnored checks path against ignore files of its parents, deepest first
+func (r *ignoreRules) isIgnored(path string, isDir bool) bool {
+	if len(r.dirs) == 0 {
+		return false
+	}
+	trimmed := strings.TrimSuffix(path, "/")
+	for i := strings.LastIndex(trimmed, "/"); i >= 0; i = strings.LastIndex(trimmed[:i], "/") {
+		dir := trimmed[:i+1]
+		f, exists := r.dirs[dir]
+		if !exists {
+			continue
+		}
+		action, matched := f.MatchRules(trimmed[i:], isDir)
+		if matched {
+			return action == filter.Exclude
+		}
+	}
+	return false
+}
@@ -10,6 +10,13 @@ type Options struct {
 	BaseDir  string
 	DirMode  os.FileMode
 	FileMode os.FileMode
+
+	// IgnoreFile is a per-dir ignore file name, empty disables it
+	IgnoreFile string
+
+	// HashCache is a file keeping hashes of files between runs, empty disables it
+	HashCache   string
+	HashWorkers int
 }
 
 func (o *Options) toRelPath(absPath string) string {
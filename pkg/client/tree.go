@@ -12,7 +12,9 @@ type TreeBuffer struct {
 	isReaden    bool
 	parents     map[string]Resource
 	children    map[string]Resource
+	excluded    map[string]Resource
 	createdDirs map[string]string
+	filter      Filter
 }
 
 func NewTreeBuffer(client Client) *TreeBuffer {
@@ -30,15 +32,81 @@ func (t *TreeBuffer) ToRelativePath(absPath string) string {
 	return t.client.ToRelativePath(absPath)
 }
 
+// SetClient replaces client of next reads, e.g. by one bound to context
+func (t *TreeBuffer) SetClient(client Client) {
+	t.client = client
+}
+
+// SetFilter leaves out not matched children on next Read
+func (t *TreeBuffer) SetFilter(filter Filter) {
+	t.filter = filter
+}
+
 func (t *TreeBuffer) Read() (err error) {
 	t.parents, t.children, err = t.client.ReadTree()
 	if err == nil {
 		t.isReaden = true
 		t.createdDirs = make(map[string]string)
+		t.applyFilter()
 	}
 	return
 }
 
+// Load fills tree from previously read children instead of ReadTree
+func (t *TreeBuffer) Load(children map[string]Resource) {
+	t.parents = make(map[string]Resource)
+	t.children = children
+	t.isReaden = true
+	t.createdDirs = make(map[string]string)
+	t.applyFilter()
+}
+
+func (t *TreeBuffer) applyFilter() {
+	t.excluded = make(map[string]Resource)
+	if t.filter == nil {
+		return
+	}
+	for path, res := range t.children {
+		if !t.filter.Match(path, res) {
+			t.excluded[path] = res
+			delete(t.children, path)
+		}
+	}
+}
+
+// GetExcluded returns children left out by filter
+func (t *TreeBuffer) GetExcluded() map[string]Resource {
+	return t.excluded
+}
+
+// GetExcludedPaths returns children left out by filter
+func (t *TreeBuffer) GetExcludedPaths() []string {
+	paths := []string{}
+	for path := range t.excluded {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Exclude moves child to excluded ones
+func (t *TreeBuffer) Exclude(path string) {
+	res, exists := t.children[path]
+	if !exists {
+		return
+	}
+	if t.excluded == nil {
+		t.excluded = make(map[string]Resource)
+	}
+	t.excluded[path] = res
+	delete(t.children, path)
+}
+
+func (t *TreeBuffer) IsExcluded(path string) bool {
+	_, excluded := t.excluded[path]
+	return excluded
+}
+
 func (t *TreeBuffer) readIfNeeded() error {
 	if t.isReaden {
 		return nil
@@ -75,6 +143,69 @@ func (t *TreeBuffer) GetChild(path string) (r Resource, exists bool) {
 	return
 }
 
+func (t *TreeBuffer) SetChild(path string, r Resource) {
+	if t.children == nil {
+		t.children = make(map[string]Resource)
+	}
+	t.children[path] = r
+}
+
+func (t *TreeBuffer) RemoveChild(path string) {
+	delete(t.children, path)
+}
+
+// Refresh re-reads single path, dropping everything below it if it is gone.
+// Filter and ignore rules of client are applied
+func (t *TreeBuffer) Refresh(path string) error {
+	path = util.PathNormalize(path, false)
+	res, exists, err := t.client.ReadResource(path)
+	if err != nil {
+		return err
+	}
+	if t.children == nil {
+		t.children = make(map[string]Resource)
+	}
+	if t.excluded == nil {
+		t.excluded = make(map[string]Resource)
+	}
+	if exists && path != "/" {
+		if ignorer, ok := t.client.(Ignorer); ok && ignorer.IsIgnored(res.Path, res.IsDir) {
+			exists = false
+		}
+	}
+	if !exists || !res.IsDir {
+		t.removeUnder(path + "/")
+	}
+	if !exists || res.IsDir {
+		delete(t.children, path)
+		delete(t.excluded, path)
+	}
+	if !exists {
+		return nil
+	}
+	delete(t.excluded, res.Path)
+	if t.filter != nil && !t.filter.Match(res.Path, res) {
+		delete(t.children, res.Path)
+		t.excluded[res.Path] = res
+		return nil
+	}
+	t.children[res.Path] = res
+	return nil
+}
+
+func (t *TreeBuffer) removeUnder(dir string) {
+	for path := range t.children {
+		if strings.HasPrefix(path, dir) {
+			delete(t.children, path)
+		}
+	}
+	for path := range t.excluded {
+		if strings.HasPrefix(path, dir) {
+			delete(t.excluded, path)
+		}
+	}
+}
+
 func (t *TreeBuffer) GetChildrenPaths() []string {
 	i := 0
 	paths := make([]string, len(t.children))
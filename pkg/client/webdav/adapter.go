@@ -1,6 +1,7 @@
 package webdav
 
 import (
+	"context"
 	"encoding/xml"
 	"fmt"
 	"io"
@@ -19,6 +20,7 @@ type Adapter struct {
 	RetryDelay time.Duration
 
 	opt         Options
+	ctx         context.Context
 	httpClient  http.Client
 	baseHeaders map[string]string
 }
@@ -26,6 +28,7 @@ type Adapter struct {
 func NewAdapter(opt Options) *Adapter {
 	return &Adapter{
 		opt:        opt,
+		ctx:        context.Background(),
 		httpClient: http.Client{},
 		baseHeaders: map[string]string{
 			"Content-Type":   "application/xml;charset=UTF-8",
@@ -38,6 +41,10 @@ func NewAdapter(opt Options) *Adapter {
 	}
 }
 
+func (c *Adapter) SetContext(ctx context.Context) {
+	c.ctx = ctx
+}
+
 func (c *Adapter) buildURI(path string) string {
 	return fmt.Sprintf(
 		"%s/%s",
@@ -53,7 +60,7 @@ func (c *Adapter) createRequest(
 ) (*http.Request, error) {
 	uri := c.buildURI(path)
 
-	req, err := http.NewRequest(method, uri, body)
+	req, err := http.NewRequestWithContext(c.ctx, method, uri, body)
 	if err != nil {
 		return req, err
 	}
@@ -104,8 +111,15 @@ func (c *Adapter) requestTry(reqFn func() (*http.Request, error)) (resp *http.Re
 		if err == nil && resp != nil && resp.StatusCode != 429 {
 			return
 		}
+		if c.ctx.Err() != nil {
+			err = c.ctx.Err()
+			return
+		}
 		log.Warnf("request retry %d of %d: \n", i+1, c.RetryLimit)
-		time.Sleep(c.RetryDelay)
+		select {
+		case <-time.After(c.RetryDelay):
+		case <-c.ctx.Done():
+		}
 	}
 	log.Warn("request tried out", err)
 	return
@@ -135,6 +149,32 @@ func (c *Adapter) Propfind(path string, depth string) (result PropfindSome, code
 	return
 }
 
+func (c *Adapter) Proppatch(path string, props string) (result Multistatus, code int, err error) {
+	resp, err := c.requestTry(func() (*http.Request, error) {
+		reqBody := strings.NewReader(
+			"<d:propertyupdate xmlns:d='DAV:'>" +
+				"<d:set><d:prop>" + props + "</d:prop></d:set>" +
+				"</d:propertyupdate>",
+		)
+		return c.createRequest("PROPPATCH", path, reqBody, map[string]string{
+			"Content-Type": "application/xml; charset=utf-8",
+		})
+	})
+	if err != nil {
+		return
+	}
+	code = resp.StatusCode
+	if code != 207 {
+		return
+	}
+	bytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	err = xml.Unmarshal(bytes, &result)
+	return
+}
+
 func (c *Adapter) Mkcol(path string) (code int, err error) {
 	req, err := c.createRequest("MKCOL", path, nil, map[string]string{})
 	if err != nil {
@@ -177,7 +217,7 @@ func (c *Adapter) PutFile(path string, body io.Reader, size int64) (code int, er
 	req.Close = true
 	resp, err := c.request(req)
 	if err != nil {
-		log.Debug("Dav adapter: PutFile error '%#v'\n", err)
+		log.Debugf("Dav adapter: PutFile error '%#v'\n", err)
 		return
 	}
 	code = resp.StatusCode
@@ -199,6 +239,22 @@ func (c *Adapter) MoveFile(srcPath, dstPath string) (code int, err error) {
 	return
 }
 
+func (c *Adapter) Copy(srcPath, dstPath string) (code int, err error) {
+	req, err := c.createRequest("COPY", srcPath, nil, map[string]string{
+		"Destination": c.buildURI(url.PathEscape(dstPath)),
+		"Depth":       "infinity",
+	})
+	if err != nil {
+		return
+	}
+	resp, err := c.request(req)
+	if err != nil {
+		return
+	}
+	code = resp.StatusCode
+	return
+}
+
 func (c *Adapter) DeleteFile(path string) (code int, err error) {
 	req, err := c.createRequest("DELETE", path, nil, map[string]string{})
 	if err != nil {
@@ -1,8 +1,11 @@
 package webdav
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"net/http"
+	"time"
 
 	"github.com/io-developer/go-davsync/pkg/client"
 	"github.com/io-developer/go-davsync/pkg/util"
@@ -12,16 +15,28 @@ type Client struct {
 	client.Client
 
 	opt     Options
+	ctx     context.Context
 	adapter *Adapter
 }
 
 func NewClient(opt Options) *Client {
 	return &Client{
 		opt:     opt,
+		ctx:     context.Background(),
 		adapter: NewAdapter(opt),
 	}
 }
 
+// WithContext returns a copy of client with requests bound to ctx
+func (c *Client) WithContext(ctx context.Context) client.Client {
+	adapter := *c.adapter
+	adapter.ctx = ctx
+	bound := *c
+	bound.ctx = ctx
+	bound.adapter = &adapter
+	return &bound
+}
+
 func (c *Client) ToAbsPath(relPath string) string {
 	return c.opt.toAbsPath(relPath)
 }
@@ -31,7 +46,7 @@ func (c *Client) ToRelativePath(absPath string) string {
 }
 
 func (c *Client) ReadTree() (parents map[string]client.Resource, children map[string]client.Resource, err error) {
-	reader := newTreeReader(c.opt, 4)
+	reader := newTreeReader(c.ctx, c.opt, 4)
 	parentItems, err := reader.readParents()
 	if err != nil {
 		return
@@ -65,6 +80,27 @@ func (c *Client) ReadResource(path string) (res client.Resource, exists bool, er
 	return
 }
 
+func (c *Client) ReadDir(path string) (children map[string]client.Resource, err error) {
+	children = map[string]client.Resource{}
+	absDir := util.PathNormalize(c.opt.toAbsPath(path), true)
+	some, code, err := c.adapter.Propfind(absDir, "1")
+	if code == 404 {
+		return children, nil
+	}
+	if err != nil {
+		return
+	}
+	for _, propfind := range some.Propfinds {
+		absPath := propfind.GetNormalizedAbsPath()
+		if absPath == absDir {
+			continue
+		}
+		childPath := c.opt.toRelPath(absPath)
+		children[childPath] = propfind.ToResource(childPath)
+	}
+	return
+}
+
 func (c *Client) MakeDir(path string) error {
 	return c.MakeDirAbs(c.opt.toAbsPath(path))
 }
@@ -115,6 +151,39 @@ func (c *Client) MoveFile(srcPath, dstPath string) error {
 	return fmt.Errorf("Webdav MoveFile (MOVE) code: %d", code)
 }
 
+func (c *Client) CopyFile(srcPath, dstPath string) error {
+	code, err := c.adapter.Copy(
+		c.opt.toAbsPath(srcPath),
+		c.opt.toAbsPath(dstPath),
+	)
+	if err != nil {
+		return err
+	}
+	if code >= 200 && code < 300 {
+		return nil
+	}
+	return fmt.Errorf("Webdav CopyFile (COPY) code: %d", code)
+}
+
+// SetModTime tries PROPPATCH of lastmodified (ownCloud, Nextcloud) and then of
+// getlastmodified, which most servers keep protected
+func (c *Client) SetModTime(path string, modTime time.Time) error {
+	props := []string{
+		fmt.Sprintf("<d:lastmodified>%d</d:lastmodified>", modTime.Unix()),
+		fmt.Sprintf("<d:getlastmodified>%s</d:getlastmodified>", modTime.UTC().Format(http.TimeFormat)),
+	}
+	for _, prop := range props {
+		result, code, err := c.adapter.Proppatch(c.opt.toAbsPath(path), prop)
+		if err != nil {
+			return err
+		}
+		if code >= 200 && code < 300 && (code != 207 || result.IsOK()) {
+			return nil
+		}
+	}
+	return client.ErrNotSupported
+}
+
 func (c *Client) DeleteFile(path string) error {
 	code, err := c.adapter.DeleteFile(c.opt.toAbsPath(path))
 	if err != nil {
@@ -125,3 +194,24 @@ func (c *Client) DeleteFile(path string) error {
 	}
 	return fmt.Errorf("Webdav DeleteFile (DELETE) code: %d", code)
 }
+
+func (c *Client) DeleteDir(path string) error {
+	absPath := util.PathNormalize(c.opt.toAbsPath(path), true)
+
+	// DELETE of collection is recursive, so make sure it is empty
+	some, _, err := c.adapter.Propfind(absPath, "1")
+	if err != nil {
+		return err
+	}
+	if len(some.Propfinds) > 1 {
+		return fmt.Errorf("Webdav DeleteDir: directory not empty '%s'", path)
+	}
+	code, err := c.adapter.DeleteFile(absPath)
+	if err != nil {
+		return err
+	}
+	if code >= 200 && code < 300 {
+		return nil
+	}
+	return fmt.Errorf("Webdav DeleteDir (DELETE) code: %d", code)
+}
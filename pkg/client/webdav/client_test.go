@@ -0,0 +1,23 @@
+package webdav
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWithContext(t *testing.T) {
+	c := NewClient(Options{DavUri: "http://localhost"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bound := c.WithContext(ctx).(*Client)
+	if bound == c || bound.adapter == c.adapter {
+		t.Fatal("client is not copied")
+	}
+	if bound.ctx != ctx || bound.adapter.ctx != ctx {
+		t.Fatal("copy is not bound to context")
+	}
+	if c.ctx != context.Background() || c.adapter.ctx != context.Background() {
+		t.Fatal("client context is changed")
+	}
+}
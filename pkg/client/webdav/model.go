@@ -4,6 +4,7 @@ import (
 	"encoding/xml"
 	"errors"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/io-developer/go-davsync/pkg/client"
@@ -28,6 +29,26 @@ type Propfind struct {
 	ResourceTypeCollection *struct{} `xml:"propstat>prop>resourcetype>collection"`
 }
 
+// Multistatus is a response of PROPPATCH
+type Multistatus struct {
+	XMLName   xml.Name `xml:"DAV: multistatus"`
+	Responses []struct {
+		Statuses []string `xml:"propstat>status"`
+	} `xml:"response"`
+}
+
+// IsOK tells whether any property was set
+func (m *Multistatus) IsOK() bool {
+	for _, resp := range m.Responses {
+		for _, status := range resp.Statuses {
+			if strings.Contains(status, " 200 ") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (p *Propfind) IsCollection() bool {
 	return p.ResourceTypeCollection != nil
 }
@@ -1,6 +1,7 @@
 package webdav
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/io-developer/go-davsync/pkg/log"
@@ -8,17 +9,19 @@ import (
 )
 
 type treeReader struct {
+	ctx         context.Context
 	opt         Options
 	numThreads  int
 	parsedItems map[string]Propfind
 	parsedPaths []string
 }
 
-func newTreeReader(opt Options, numThreads int) *treeReader {
+func newTreeReader(ctx context.Context, opt Options, numThreads int) *treeReader {
 	if numThreads < 1 {
 		numThreads = 1
 	}
 	return &treeReader{
+		ctx:        ctx,
 		opt:        opt,
 		numThreads: numThreads,
 	}
@@ -28,8 +31,14 @@ func (r *treeReader) log(msg string) {
 	log.Infof("Dav tree: %s\n", msg)
 }
 
-func (r *treeReader) readParents() (parents map[string]Propfind, err error) {
+func (r *treeReader) newAdapter() *Adapter {
 	adapter := NewAdapter(r.opt)
+	adapter.SetContext(r.ctx)
+	return adapter
+}
+
+func (r *treeReader) readParents() (parents map[string]Propfind, err error) {
+	adapter := r.newAdapter()
 
 	parents = map[string]Propfind{}
 	parentPaths := util.PathParents(util.PathNormalizeBaseDir(r.opt.BaseDir))
@@ -153,7 +162,7 @@ func (r *treeReader) thread(id int, queue, parsed, completed, errors chan treeMs
 	}
 	logThread("Thread started..")
 
-	adapter := NewAdapter(r.opt)
+	adapter := r.newAdapter()
 	for {
 		select {
 		case msg, success := <-queue:
@@ -1,7 +1,9 @@
 package yadisk
 
 import (
+	"context"
 	"io"
+	"time"
 
 	"github.com/io-developer/go-davsync/pkg/client"
 	"github.com/io-developer/go-davsync/pkg/client/webdav"
@@ -22,6 +24,14 @@ func NewClient(dav *webdav.Client, rest *yadiskrest.Client) *Client {
 	}
 }
 
+// WithContext returns a copy of client with requests bound to ctx
+func (c *Client) WithContext(ctx context.Context) client.Client {
+	return &Client{
+		dav:  c.dav.WithContext(ctx).(*webdav.Client),
+		rest: c.rest.WithContext(ctx).(*yadiskrest.Client),
+	}
+}
+
 func (c *Client) ToAbsPath(relPath string) string {
 	return c.dav.ToAbsPath(relPath)
 }
@@ -36,6 +46,9 @@ func (c *Client) ReadTree() (parents, children map[string]client.Resource, err e
 func (c *Client) ReadResource(path string) (res client.Resource, exists bool, err error) {
 	return c.rest.ReadResource(path)
 }
+func (c *Client) ReadDir(path string) (children map[string]client.Resource, err error) {
+	return c.rest.ReadDir(path)
+}
 
 func (c *Client) MakeDir(path string) error {
 	return c.dav.MakeDir(path)
@@ -53,6 +66,15 @@ func (c *Client) WriteFile(path string, content io.ReadCloser, size int64) error
 func (c *Client) MoveFile(srcPath, dstPath string) error {
 	return c.dav.MoveFile(srcPath, dstPath)
 }
+func (c *Client) CopyFile(srcPath, dstPath string) error {
+	return c.rest.CopyFile(srcPath, dstPath)
+}
+func (c *Client) SetModTime(path string, modTime time.Time) error {
+	return c.rest.SetModTime(path, modTime)
+}
 func (c *Client) DeleteFile(path string) error {
 	return c.dav.DeleteFile(path)
 }
+func (c *Client) DeleteDir(path string) error {
+	return c.dav.DeleteDir(path)
+}
@@ -1,6 +1,8 @@
 package yadiskrest
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -24,13 +26,19 @@ type Client struct {
 	RetryDelay time.Duration
 
 	opt         Options
+	ctx         context.Context
 	httpClient  http.Client
 	baseHeaders map[string]string
 
-	treeParents     map[string]Resource
-	treeParentPaths []string
-	treeItems       map[string]Resource
-	treeItemPaths   []string
+	tree *tree
+}
+
+// tree is read once and shared by copies of client bound to other contexts
+type tree struct {
+	parents     map[string]Resource
+	parentPaths []string
+	items       map[string]Resource
+	itemPaths   []string
 }
 
 func NewClient(opt Options) *Client {
@@ -39,14 +47,23 @@ func NewClient(opt Options) *Client {
 		RetryDelay: 1 * time.Second,
 
 		opt:        opt,
+		ctx:        context.Background(),
 		httpClient: http.Client{},
 		baseHeaders: map[string]string{
 			"Accept":     "*/*",
 			"Connection": "keep-alive",
 		},
+		tree: &tree{},
 	}
 }
 
+// WithContext returns a copy of client with requests bound to ctx
+func (c *Client) WithContext(ctx context.Context) client.Client {
+	bound := *c
+	bound.ctx = ctx
+	return &bound
+}
+
 func (c *Client) ToAbsPath(relPath string) string {
 	return c.opt.toAbsPath(relPath)
 }
@@ -61,11 +78,11 @@ func (c *Client) ReadTree() (parents map[string]client.Resource, children map[st
 		return
 	}
 	parents = map[string]client.Resource{}
-	for absPath, parent := range c.treeParents {
+	for absPath, parent := range c.tree.parents {
 		parents[absPath] = parent.ToResource(absPath)
 	}
 	children = map[string]client.Resource{}
-	for path, item := range c.treeItems {
+	for path, item := range c.tree.items {
 		children[path] = item.ToResource(path)
 	}
 	return
@@ -75,11 +92,10 @@ func (c *Client) ReadResource(path string) (res client.Resource, exists bool, er
 	resp, err := c.request("GET", "/resources/", url.Values{
 		"path": []string{c.opt.toAbsPath(path)},
 	})
-	if resp.StatusCode == 404 {
-		err = nil
+	if err != nil {
 		return
 	}
-	if err != nil {
+	if resp.StatusCode == 404 {
 		return
 	}
 	bytes, err := ioutil.ReadAll(resp.Body)
@@ -96,6 +112,34 @@ func (c *Client) ReadResource(path string) (res client.Resource, exists bool, er
 	return
 }
 
+func (c *Client) ReadDir(path string) (children map[string]client.Resource, err error) {
+	children = map[string]client.Resource{}
+	resp, err := c.request("GET", "/resources/", url.Values{
+		"path":  []string{c.opt.toAbsPath(path)},
+		"limit": []string{"999999"},
+	})
+	if err != nil {
+		return
+	}
+	if resp.StatusCode == 404 {
+		return
+	}
+	bytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	dir := Resource{}
+	err = json.Unmarshal(bytes, &dir)
+	if err != nil || dir.Embedded == nil {
+		return
+	}
+	for _, item := range dir.Embedded.Items {
+		childPath := c.opt.toRelPath(item.GetNormalizedAbsPath())
+		children[childPath] = item.ToResource(childPath)
+	}
+	return
+}
+
 func (c *Client) MakeDir(path string) error {
 	return c.MakeDirAbs(c.opt.toAbsPath(path))
 }
@@ -122,7 +166,7 @@ func (c *Client) ReadFile(path string) (reader io.ReadCloser, err error) {
 	if err != nil {
 		return
 	}
-	item, exists := c.treeItems[path]
+	item, exists := c.tree.items[path]
 	if !exists {
 		err = fmt.Errorf("Resource not found '%s'", path)
 		return
@@ -135,7 +179,7 @@ func (c *Client) ReadFile(path string) (reader io.ReadCloser, err error) {
 		err = fmt.Errorf("Resource download uri is empty at '%s'", path)
 		return
 	}
-	req, err := http.NewRequest("GET", item.File, nil)
+	req, err := http.NewRequestWithContext(c.ctx, "GET", item.File, nil)
 	if err != nil {
 		return
 	}
@@ -171,11 +215,11 @@ func (c *Client) WriteFile(path string, content io.ReadCloser, size int64) error
 	if err != nil {
 		return err
 	}
-	log.Debug("UploadInfo:\n%#v\n", info)
+	log.Debugf("UploadInfo:\n%#v\n", info)
 	if info.Templated {
 		return fmt.Errorf("Unexpected templated=true.\n  Info: %#v", info)
 	}
-	req, err := http.NewRequest(info.Method, info.Href, content)
+	req, err := http.NewRequestWithContext(c.ctx, info.Method, info.Href, content)
 	if err != nil {
 		return err
 	}
@@ -209,6 +253,99 @@ func (c *Client) MoveFile(srcPath, dstPath string) error {
 	return fmt.Errorf("Unexpected MoveFile (MOVE) code: %d", code)
 }
 
+func (c *Client) CopyFile(srcPath, dstPath string) error {
+	req, err := c.createRequest("POST", "/resources/copy", url.Values{
+		"from":      []string{c.opt.toAbsPath(srcPath)},
+		"path":      []string{c.opt.toAbsPath(dstPath)},
+		"overwrite": []string{"true"},
+	}, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.sendRequest(req)
+	if err != nil {
+		return err
+	}
+	code := resp.StatusCode
+	if code == 202 {
+		// copying of dirs is asynchronous
+		return c.waitOperation(resp)
+	}
+	if code >= 200 && code < 300 {
+		return nil
+	}
+	return fmt.Errorf("Unexpected CopyFile (COPY) code: %d", code)
+}
+
+// waitOperation polls status of asynchronous operation until it is over
+func (c *Client) waitOperation(resp *http.Response) error {
+	bytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	link := Link{}
+	err = json.Unmarshal(bytes, &link)
+	if err != nil {
+		return err
+	}
+	for {
+		req, err := http.NewRequestWithContext(c.ctx, "GET", link.Href, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := c.sendRequest(c.auth(req))
+		if err != nil {
+			return err
+		}
+		bytes, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		op := Operation{}
+		err = json.Unmarshal(bytes, &op)
+		if err != nil {
+			return err
+		}
+		switch op.Status {
+		case "success":
+			return nil
+		case "failed":
+			return fmt.Errorf("Operation failed '%s'", link.Href)
+		}
+		select {
+		case <-time.After(c.RetryDelay):
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		}
+	}
+}
+
+// SetModTime stores mtime in custom properties, Disk keeps upload time itself
+func (c *Client) SetModTime(path string, modTime time.Time) error {
+	body, err := json.Marshal(map[string]map[string]string{
+		"custom_properties": {ModTimeProperty: modTime.Format(time.RFC3339Nano)},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := c.createRequest("PATCH", "/resources", url.Values{
+		"path": []string{c.opt.toAbsPath(path)},
+	}, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.sendRequest(req)
+	if err != nil {
+		return err
+	}
+	code := resp.StatusCode
+	if code >= 200 && code < 300 {
+		return nil
+	}
+	return fmt.Errorf("Unexpected SetModTime (PATCH) code: %d", code)
+}
+
 func (c *Client) DeleteFile(path string) error {
 	permanently := "false"
 	if c.opt.DeletePermanent {
@@ -232,8 +369,30 @@ func (c *Client) DeleteFile(path string) error {
 	return fmt.Errorf("Unexpected DeleteFile (DELETE) code: %d", code)
 }
 
+func (c *Client) DeleteDir(path string) error {
+	bytes, err := c.requestBytes("GET", "/resources", url.Values{
+		"path":  []string{c.opt.toAbsPath(path)},
+		"limit": []string{"1"},
+	})
+	if err != nil {
+		return err
+	}
+	dir := Resource{}
+	err = json.Unmarshal(bytes, &dir)
+	if err != nil {
+		return err
+	}
+	if !dir.IsDir() {
+		return fmt.Errorf("Resource is not a dir (%s) at '%s'", dir.Type, path)
+	}
+	if dir.Embedded != nil && (dir.Embedded.Total > 0 || len(dir.Embedded.Items) > 0) {
+		return fmt.Errorf("Directory not empty '%s'", path)
+	}
+	return c.DeleteFile(path)
+}
+
 func (c *Client) readTree() error {
-	if c.treeItems != nil {
+	if c.tree.items != nil {
 		return nil
 	}
 	bytes, err := c.requestBytes("GET", "/resources/files", url.Values{
@@ -249,10 +408,10 @@ func (c *Client) readTree() error {
 		return err
 	}
 
-	c.treeParents = map[string]Resource{}
-	c.treeParentPaths = []string{}
-	c.treeItems = map[string]Resource{}
-	c.treeItemPaths = []string{}
+	c.tree.parents = map[string]Resource{}
+	c.tree.parentPaths = []string{}
+	c.tree.items = map[string]Resource{}
+	c.tree.itemPaths = []string{}
 
 	log.Debug("read tree: filling tree and parents...")
 	for _, item := range r.Items {
@@ -260,13 +419,13 @@ func (c *Client) readTree() error {
 	}
 
 	log.Debug("read tree: sorting parent paths...")
-	sort.Slice(c.treeParentPaths, func(i, j int) bool {
-		return c.treeParentPaths[i] < c.treeParentPaths[j]
+	sort.Slice(c.tree.parentPaths, func(i, j int) bool {
+		return c.tree.parentPaths[i] < c.tree.parentPaths[j]
 	})
 
 	log.Debug("read tree: sorting item paths...")
-	sort.Slice(c.treeItemPaths, func(i, j int) bool {
-		return c.treeItemPaths[i] < c.treeItemPaths[j]
+	sort.Slice(c.tree.itemPaths, func(i, j int) bool {
+		return c.tree.itemPaths[i] < c.tree.itemPaths[j]
 	})
 
 	log.Debug("read tree: complete")
@@ -277,35 +436,35 @@ func (c *Client) appendTree(item Resource) {
 	absPath := item.GetNormalizedAbsPath()
 	if strings.HasPrefix(absPath, c.opt.getBaseDir()) {
 		path := c.opt.toRelPath(absPath)
-		c.treeItems[path] = item
-		c.treeItemPaths = append(c.treeItemPaths, path)
+		c.tree.items[path] = item
+		c.tree.itemPaths = append(c.tree.itemPaths, path)
 
 		// add missing dirs
 		for _, dirPath := range util.PathParents(path) {
-			if _, exists := c.treeItems[dirPath]; exists {
+			if _, exists := c.tree.items[dirPath]; exists {
 				continue
 			}
 			log.Debug("read tree: appending dir", dirPath)
-			c.treeItems[dirPath] = c.createDirResource(c.opt.toAbsPath(dirPath))
-			c.treeItemPaths = append(c.treeItemPaths, dirPath)
+			c.tree.items[dirPath] = c.createDirResource(c.opt.toAbsPath(dirPath))
+			c.tree.itemPaths = append(c.tree.itemPaths, dirPath)
 		}
 	}
 
 	// add missing parents
 	for _, parentAbsPath := range util.PathParents(absPath) {
-		if _, exists := c.treeParents[parentAbsPath]; exists {
+		if _, exists := c.tree.parents[parentAbsPath]; exists {
 			continue
 		}
 		if !strings.HasPrefix(c.opt.getBaseDir(), parentAbsPath) {
 			continue
 		}
 		if parentAbsPath == absPath {
-			c.treeParents[parentAbsPath] = item
+			c.tree.parents[parentAbsPath] = item
 			continue
 		}
 		log.Debug("read tree: appending parent", parentAbsPath)
-		c.treeParents[parentAbsPath] = c.createDirResource(parentAbsPath)
-		c.treeParentPaths = append(c.treeParentPaths, parentAbsPath)
+		c.tree.parents[parentAbsPath] = c.createDirResource(parentAbsPath)
+		c.tree.parentPaths = append(c.tree.parentPaths, parentAbsPath)
 	}
 }
 
@@ -338,11 +497,17 @@ func (c *Client) request(method, path string, query url.Values) (resp *http.Resp
 func (c *Client) sendRequest(req *http.Request) (resp *http.Response, err error) {
 	for i := 0; i < c.RetryLimit; i++ {
 		resp, err = c.httpClient.Do(req)
+		if c.ctx.Err() != nil {
+			return resp, c.ctx.Err()
+		}
 		if err != nil {
 			continue
 		}
 		if resp.StatusCode == 429 {
-			time.Sleep(c.RetryDelay)
+			select {
+			case <-time.After(c.RetryDelay):
+			case <-c.ctx.Done():
+			}
 			continue
 		}
 		break
@@ -358,7 +523,7 @@ func (c *Client) createRequest(method, path string, query url.Values, body io.Re
 	uri := c.buildURI(path, query)
 	log.Debugf("createRequest\n  path: %s\n  uri: %s\n  method: %s\n\n", path, uri, method)
 
-	req, err := http.NewRequest(method, uri, body)
+	req, err := http.NewRequestWithContext(c.ctx, method, uri, body)
 	if err != nil {
 		return req, err
 	}
@@ -10,21 +10,39 @@ import (
 
 type Resources struct {
 	Items []Resource `json:"items"`
+	Total int        `json:"total"`
 }
 
 type Resource struct {
-	ResourceID string    `json:"resource_id"`
-	Path       string    `json:"path"`
-	Type       string    `json:"type"`
-	MediaType  string    `json:"media_type"`
-	MimeType   string    `json:"mime_type"`
-	Created    time.Time `json:"created"`
-	Modified   time.Time `json:"modified"`
-	Name       string    `json:"name"`
-	File       string    `json:"file"`
-	Size       int64     `json:"size"`
-	Md5        string    `json:"md5"`
-	Sha256     string    `json:"sha256,omitempty"`
+	ResourceID string     `json:"resource_id"`
+	Path       string     `json:"path"`
+	Type       string     `json:"type"`
+	MediaType  string     `json:"media_type"`
+	MimeType   string     `json:"mime_type"`
+	Created    time.Time  `json:"created"`
+	Modified   time.Time  `json:"modified"`
+	Name       string     `json:"name"`
+	File       string     `json:"file"`
+	Size       int64      `json:"size"`
+	Md5        string     `json:"md5"`
+	Sha256     string     `json:"sha256,omitempty"`
+	Embedded   *Resources `json:"_embedded,omitempty"`
+
+	CustomProperties map[string]string `json:"custom_properties,omitempty"`
+}
+
+// ModTimeProperty keeps source mtime in custom properties
+const ModTimeProperty = "mtime"
+
+// Link points to asynchronous operation
+type Link struct {
+	Href   string `json:"href"`
+	Method string `json:"method"`
+}
+
+// Operation is a status of asynchronous operation
+type Operation struct {
+	Status string `json:"status"`
 }
 
 func (r Resource) IsFile() bool {
@@ -41,6 +59,11 @@ func (r Resource) GetNormalizedAbsPath() string {
 }
 
 func (r Resource) GetModTime() time.Time {
+	if mtime, exists := r.CustomProperties[ModTimeProperty]; exists {
+		if t, err := time.Parse(time.RFC3339Nano, mtime); err == nil {
+			return t
+		}
+	}
 	if r.Modified.Unix() == 0 {
 		return r.Created
 	}
@@ -0,0 +1,263 @@
+package filter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+)
+
+// Action of rule
+type Action string
+
+// Rule actions
+const (
+	Include = Action("Include")
+	Exclude = Action("Exclude")
+)
+
+// Rule matches path by gitignore-style glob or by regex.
+// Regex is matched against full relative path, dirs having trailing slash
+type Rule struct {
+	Action  Action
+	Pattern string
+	Regex   bool
+}
+
+// Options of filter. The last matching rule wins, like in gitignore.
+// Zero limits are disabled. Limits apply to files only
+type Options struct {
+	Rules   []Rule
+	MinSize int64
+	MaxSize int64
+	MinAge  time.Duration
+	MaxAge  time.Duration
+}
+
+// Filter decides which resources take part in sync
+type Filter struct {
+	opt   Options
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	action  Action
+	re      *regexp.Regexp
+	glob    bool
+	dirOnly bool
+}
+
+// New compiles filter options
+func New(opt Options) (*Filter, error) {
+	f := &Filter{
+		opt:   opt,
+		rules: []compiledRule{},
+	}
+	for _, rule := range opt.Rules {
+		if rule.Action != Include && rule.Action != Exclude {
+			return nil, fmt.Errorf("Unexpected filter action '%s'", rule.Action)
+		}
+		compiled := compiledRule{action: rule.Action, glob: !rule.Regex}
+		var err error
+		if rule.Regex {
+			compiled.re, err = regexp.Compile(rule.Pattern)
+		} else {
+			compiled.re, compiled.dirOnly, err = CompileGlob(rule.Pattern)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Unexpected filter pattern '%s': %v", rule.Pattern, err)
+		}
+		f.rules = append(f.rules, compiled)
+	}
+	return f, nil
+}
+
+// IsEmpty reports whether filter passes everything
+func (f *Filter) IsEmpty() bool {
+	return f == nil || (len(f.rules) == 0 &&
+		f.opt.MinSize == 0 && f.opt.MaxSize == 0 &&
+		f.opt.MinAge == 0 && f.opt.MaxAge == 0)
+}
+
+// WithoutAge returns filter of the same rules and size limits. Output files
+// get mtime of their upload, so age limits apply to input only
+func (f *Filter) WithoutAge() *Filter {
+	if f == nil {
+		return nil
+	}
+	copied := *f
+	copied.opt.MinAge = 0
+	copied.opt.MaxAge = 0
+	return &copied
+}
+
+// Match reports whether resource is included. Resource is excluded
+// along with everything below any excluded parent dir
+func (f *Filter) Match(path string, res client.Resource) bool {
+	if f.IsEmpty() || path == "/" {
+		return true
+	}
+	for _, dir := range parentDirs(path) {
+		if !f.matchRules(dir, true) {
+			return false
+		}
+	}
+	if !f.matchRules(path, res.IsDir) {
+		return false
+	}
+	if res.IsDir {
+		return true
+	}
+	return f.matchLimits(res)
+}
+
+// matchRules applies the last matching rule, unmatched paths are included
+func (f *Filter) matchRules(path string, isDir bool) bool {
+	action, matched := f.MatchRules(path, isDir)
+	return !matched || action == Include
+}
+
+// MatchRules returns action of the last rule matching path
+func (f *Filter) MatchRules(path string, isDir bool) (action Action, matched bool) {
+	globPath := strings.TrimSuffix(path, "/")
+	if isDir {
+		path = globPath + "/"
+	}
+	for i := len(f.rules) - 1; i >= 0; i-- {
+		rule := f.rules[i]
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.glob {
+			matched = rule.re.MatchString(globPath)
+		} else {
+			matched = rule.re.MatchString(path)
+		}
+		if matched {
+			return rule.action, true
+		}
+	}
+	return "", false
+}
+
+func (f *Filter) matchLimits(res client.Resource) bool {
+	if f.opt.MinSize > 0 && res.Size < f.opt.MinSize {
+		return false
+	}
+	if f.opt.MaxSize > 0 && res.Size > f.opt.MaxSize {
+		return false
+	}
+	// long running watch and daemon keep filter, age is of the moment
+	age := time.Now().Sub(res.ModTime)
+	if f.opt.MinAge > 0 && age < f.opt.MinAge {
+		return false
+	}
+	if f.opt.MaxAge > 0 && age > f.opt.MaxAge {
+		return false
+	}
+	return true
+}
+
+// parentDirs returns "/a/", "/a/b/" for "/a/b/c"
+func parentDirs(path string) []string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	dirs := []string{}
+	dir := "/"
+	for _, part := range parts[:len(parts)-1] {
+		dir += part + "/"
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// CompileGlob converts gitignore-style glob to regex matched against
+// relative path without trailing slash. Pattern with slash at the
+// beginning or in the middle is anchored to root, otherwise it matches
+// at any depth. Trailing slash matches dirs only
+func CompileGlob(pattern string) (re *regexp.Regexp, dirOnly bool, err error) {
+	dirOnly = strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if pattern == "" {
+		return nil, false, fmt.Errorf("Empty pattern")
+	}
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	expr := ""
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr += "(?:.*/)?"
+			i += 2
+		case strings.HasPrefix(pattern[i:], "/**") && i+3 == len(pattern):
+			expr += "(?:/.*)?"
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr += ".*"
+			i++
+		case c == '*':
+			expr += "[^/]*"
+		case c == '?':
+			expr += "[^/]"
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, false, fmt.Errorf("Unclosed bracket")
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr += "[" + class + "]"
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			expr += regexp.QuoteMeta(pattern[i+1 : i+2])
+			i++
+		default:
+			expr += regexp.QuoteMeta(string(c))
+		}
+	}
+	if anchored {
+		expr = "^/" + expr + "$"
+	} else {
+		expr = "(?:^|/)" + expr + "$"
+	}
+	re, err = regexp.Compile(expr)
+	return
+}
+
+// ParseRules reads gitignore-style lines: "#" comments, "!" includes
+func ParseRules(r io.Reader) ([]Rule, error) {
+	rules := []Rule{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := Rule{Action: Exclude, Pattern: line}
+		if strings.HasPrefix(line, "!") {
+			rule = Rule{Action: Include, Pattern: line[1:]}
+		} else if strings.HasPrefix(line, "\\") {
+			rule.Pattern = line[1:]
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// ParseRulesFile reads rules from gitignore-style file
+func ParseRulesFile(path string) ([]Rule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseRules(file)
+}
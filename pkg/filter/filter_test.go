@@ -0,0 +1,224 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+)
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+		dirOnly bool
+	}{
+		{"*.tmp", "/a.tmp", true, false},
+		{"*.tmp", "/dir/a.tmp", true, false},
+		{"*.tmp", "/a.tmp.bak", false, false},
+		{"/build", "/build", true, false},
+		{"/build", "/sub/build", false, false},
+		{"docs/*.md", "/docs/a.md", true, false},
+		{"docs/*.md", "/sub/docs/a.md", false, false},
+		{"docs/*.md", "/docs/sub/a.md", false, false},
+		{"**/cache", "/cache", true, false},
+		{"**/cache", "/a/b/cache", true, false},
+		{"logs/**", "/logs/a/b", true, false},
+		{"a/**/b", "/a/b", true, false},
+		{"a/**/b", "/a/x/y/b", true, false},
+		{".git/", "/.git", true, true},
+		{"file?.txt", "/file1.txt", true, false},
+		{"file?.txt", "/file12.txt", false, false},
+		{"[ab].txt", "/a.txt", true, false},
+		{"[!ab].txt", "/a.txt", false, false},
+		{"[!ab].txt", "/c.txt", true, false},
+		{"\\!important", "/!important", true, false},
+		{"a.b", "/axb", false, false},
+	}
+	for _, test := range tests {
+		re, dirOnly, err := CompileGlob(test.pattern)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.pattern, err)
+			continue
+		}
+		if dirOnly != test.dirOnly {
+			t.Errorf("%q: dirOnly %t, expected %t", test.pattern, dirOnly, test.dirOnly)
+		}
+		if match := re.MatchString(test.path); match != test.match {
+			t.Errorf("%q on %q: match %t, expected %t", test.pattern, test.path, match, test.match)
+		}
+	}
+}
+
+func TestCompileGlobErrors(t *testing.T) {
+	for _, pattern := range []string{"", "/", "[abc"} {
+		if _, _, err := CompileGlob(pattern); err == nil {
+			t.Errorf("%q: expected error", pattern)
+		}
+	}
+}
+
+func TestMatchRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []Rule
+		path    string
+		isDir   bool
+		action  Action
+		matched bool
+	}{
+		{
+			name:  "unmatched",
+			rules: []Rule{{Action: Exclude, Pattern: "*.tmp"}},
+			path:  "/a.txt",
+		},
+		{
+			name:    "exclude",
+			rules:   []Rule{{Action: Exclude, Pattern: "*.tmp"}},
+			path:    "/a.tmp",
+			action:  Exclude,
+			matched: true,
+		},
+		{
+			name: "include after exclude wins",
+			rules: []Rule{
+				{Action: Exclude, Pattern: "*.log"},
+				{Action: Include, Pattern: "keep.log"},
+			},
+			path:    "/keep.log",
+			action:  Include,
+			matched: true,
+		},
+		{
+			name: "exclude after include wins",
+			rules: []Rule{
+				{Action: Include, Pattern: "keep.log"},
+				{Action: Exclude, Pattern: "*.log"},
+			},
+			path:    "/keep.log",
+			action:  Exclude,
+			matched: true,
+		},
+		{
+			name:  "dir only rule skips files",
+			rules: []Rule{{Action: Exclude, Pattern: "cache/"}},
+			path:  "/cache",
+		},
+		{
+			name:    "dir only rule matches dirs",
+			rules:   []Rule{{Action: Exclude, Pattern: "cache/"}},
+			path:    "/a/cache/",
+			isDir:   true,
+			action:  Exclude,
+			matched: true,
+		},
+		{
+			name:    "regex sees trailing slash of dirs",
+			rules:   []Rule{{Action: Exclude, Pattern: "^/tmp/$", Regex: true}},
+			path:    "/tmp",
+			isDir:   true,
+			action:  Exclude,
+			matched: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f, err := New(Options{Rules: test.rules})
+			if err != nil {
+				t.Fatal(err)
+			}
+			action, matched := f.MatchRules(test.path, test.isDir)
+			if action != test.action || matched != test.matched {
+				t.Errorf("got (%q, %t), expected (%q, %t)", action, matched, test.action, test.matched)
+			}
+		})
+	}
+}
+
+func TestParseRulesNegation(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader("# comment\n*.log\n\n!keep.log\n\\#hash\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 3 || rules[1].Action != Include || rules[2].Pattern != "#hash" {
+		t.Fatalf("unexpected rules %+v", rules)
+	}
+	f, err := New(Options{Rules: rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"/a.log":        false,
+		"/keep.log":     true,
+		"/sub/keep.log": true,
+		"/a.txt":        true,
+	}
+	for path, included := range tests {
+		if f.Match(path, client.Resource{Path: path}) != included {
+			t.Errorf("%s: expected included %t", path, included)
+		}
+	}
+}
+
+func TestMatchExcludedParent(t *testing.T) {
+	f, err := New(Options{Rules: []Rule{
+		{Action: Exclude, Pattern: "build/"},
+		{Action: Include, Pattern: "*.txt"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Match("/build/a.txt", client.Resource{}) {
+		t.Error("path under excluded dir must stay excluded")
+	}
+	if !f.Match("/src/a.txt", client.Resource{}) {
+		t.Error("unexpected exclusion")
+	}
+}
+
+func TestMatchLimits(t *testing.T) {
+	f, err := New(Options{MinSize: 10, MaxSize: 100, MinAge: time.Hour, MaxAge: 48 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	tests := []struct {
+		name     string
+		res      client.Resource
+		included bool
+	}{
+		{"fits", client.Resource{Size: 50, ModTime: now.Add(-2 * time.Hour)}, true},
+		{"too small", client.Resource{Size: 5, ModTime: now.Add(-2 * time.Hour)}, false},
+		{"too large", client.Resource{Size: 500, ModTime: now.Add(-2 * time.Hour)}, false},
+		{"too new", client.Resource{Size: 50, ModTime: now}, false},
+		{"too old", client.Resource{Size: 50, ModTime: now.Add(-72 * time.Hour)}, false},
+		{"dirs have no limits", client.Resource{IsDir: true}, true},
+	}
+	for _, test := range tests {
+		if f.Match("/x", test.res) != test.included {
+			t.Errorf("%s: expected included %t", test.name, test.included)
+		}
+	}
+}
+
+func TestWithoutAge(t *testing.T) {
+	f, err := New(Options{MaxSize: 100, MinAge: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := f.WithoutAge()
+	if !f.Match("/x", client.Resource{Size: 50, ModTime: time.Now().Add(-2 * time.Hour)}) {
+		t.Error("old file excluded")
+	}
+	if output.Match("/x", client.Resource{Size: 500}) {
+		t.Error("size limit dropped")
+	}
+	if !output.Match("/x", client.Resource{Size: 50, ModTime: time.Now()}) {
+		t.Error("age limit kept")
+	}
+	if f.Match("/x", client.Resource{Size: 50, ModTime: time.Now()}) {
+		t.Error("age limit dropped from original filter")
+	}
+}
@@ -1,17 +1,22 @@
 package log
 
+import "sync"
+
 type ThreadLog struct {
 	Id       int
 	TaskId   int
 	Complete bool
 	Level    Level
 	Msg      string
+	Path     string
 }
 
 type ThreadLogger struct {
 	logger   *Logger
 	logs     <-chan ThreadLog
 	capacity uint
+	buf      []ThreadLog
+	bufMu    sync.Mutex
 }
 
 func NewThreadLogger(logs <-chan ThreadLog, capacity uint) *ThreadLogger {
@@ -19,7 +24,21 @@ func NewThreadLogger(logs <-chan ThreadLog, capacity uint) *ThreadLogger {
 		logger:   DefaultLogger,
 		logs:     logs,
 		capacity: capacity,
+		buf:      make([]ThreadLog, capacity),
+	}
+}
+
+// Snapshot returns the last log of each busy thread
+func (l *ThreadLogger) Snapshot() []ThreadLog {
+	l.bufMu.Lock()
+	defer l.bufMu.Unlock()
+	items := []ThreadLog{}
+	for _, item := range l.buf {
+		if !item.Complete && item.Msg != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
 
 func (l *ThreadLogger) SetLogger(logger *Logger) {
@@ -27,7 +46,7 @@ func (l *ThreadLogger) SetLogger(logger *Logger) {
 }
 
 func (l *ThreadLogger) Listen() {
-	buf := make([]ThreadLog, l.capacity)
+	buf := l.buf
 	lastCount := int64(0)
 	printBuf := func() {
 		for _, item := range buf {
@@ -58,7 +77,9 @@ func (l *ThreadLogger) Listen() {
 			if isDelimer && !bufItem.Complete {
 				l.logger.Info(bufItem.Msg)
 			}
+			l.bufMu.Lock()
 			buf[item.Id] = item
+			l.bufMu.Unlock()
 			printBuf()
 		}
 	}
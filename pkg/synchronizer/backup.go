@@ -0,0 +1,128 @@
+package synchronizer
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+	"github.com/io-developer/go-davsync/pkg/util"
+)
+
+// BackupTimeFormat names backup set dirs, one set per run
+const BackupTimeFormat = "2006-01-02T15-04-05"
+
+// backupFilter keeps backup dir out of both trees
+type backupFilter struct {
+	dir    string
+	filter client.Filter
+}
+
+func (f backupFilter) Match(path string, res client.Resource) bool {
+	if strings.HasPrefix(path, f.dir) {
+		return false
+	}
+	return f.filter == nil || f.filter.Match(path, res)
+}
+
+func (s *OneWay) isBackupPath(path string) bool {
+	return s.opt.BackupDir != "" && strings.HasPrefix(path, s.opt.BackupDir)
+}
+
+func (s *OneWay) startBackupSet() {
+	s.backupMu.Lock()
+	s.backupSet = time.Now().Format(BackupTimeFormat)
+	s.backups = map[string]bool{}
+	s.backupMu.Unlock()
+}
+
+func (s *OneWay) backedUpCount() int {
+	s.backupMu.Lock()
+	defer s.backupMu.Unlock()
+	count := 0
+	for _, moved := range s.backups {
+		if moved {
+			count++
+		}
+	}
+	return count
+}
+
+// backsUpOverwritten tells whether writing the file backs up its existing
+// output version
+func (s *OneWay) backsUpOverwritten(path string) bool {
+	if s.opt.BackupDir == "" {
+		return false
+	}
+	_, exists := s.outputTree.GetChild(path)
+	return exists
+}
+
+// backupOverwritten backs up existing output version of file about to be written
+func (s *OneWay) backupOverwritten(path string, logFn func(string)) error {
+	if !s.backsUpOverwritten(path) {
+		return nil
+	}
+	return s.backupOutputFile(path, logFn)
+}
+
+// backupOutputFile moves output file into backup set of current run
+// instead of deleting it. Repeated calls for the same path do nothing
+func (s *OneWay) backupOutputFile(filePath string, logFn func(string)) error {
+	s.backupMu.Lock()
+	if _, handled := s.backups[filePath]; handled {
+		s.backupMu.Unlock()
+		return nil
+	}
+	backupPath := util.PathNormalize(s.opt.BackupDir+s.backupSet+filePath, false)
+	err := s.outputTree.MakeDir(path.Dir(backupPath), true)
+	s.backupMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	logFn(fmt.Sprintf("Backing up to %s", backupPath))
+	moved := true
+	err = s.output.MoveFile(filePath, backupPath)
+	if err != nil {
+		_, exists, resErr := s.output.ReadResource(filePath)
+		if resErr != nil || exists {
+			return err
+		}
+		logFn("Not exists. Nothing to back up")
+		moved = false
+	}
+
+	s.backupMu.Lock()
+	s.backups[filePath] = moved
+	s.backupMu.Unlock()
+	return nil
+}
+
+// pruneBackups deletes backup sets beyond BackupKeepCount newest ones and
+// older than BackupKeepAge. Backup set of current run is always kept
+func (s *OneWay) pruneBackups(errors chan<- error) {
+	if s.opt.BackupDir == "" || (s.opt.BackupKeepAge <= 0 && s.opt.BackupKeepCount <= 0) {
+		return
+	}
+	reader, ok := s.output.(client.DirReader)
+	if !ok {
+		s.log("Backup: retention is not supported by output client")
+		return
+	}
+	sets, err := readDatedDirs(reader, s.opt.BackupDir, BackupTimeFormat)
+	if err != nil {
+		s.reportError("PruneBackups", s.opt.BackupDir, err)
+		errors <- err
+		return
+	}
+	for _, set := range expiredDirs(sets, s.opt.BackupKeepCount, s.opt.BackupKeepAge, s.backupSet) {
+		s.log(fmt.Sprintf("Backup: deleting %s", set.path))
+		err := deleteTree(s.output, reader, set.path)
+		if err != nil {
+			s.reportError("PruneBackups", set.path, err)
+			errors <- err
+		}
+	}
+}
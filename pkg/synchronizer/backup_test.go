@@ -0,0 +1,72 @@
+package synchronizer
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client/local"
+)
+
+// failingWriteClient fails every file write halfway
+type failingWriteClient struct {
+	*local.Client
+}
+
+func (c failingWriteClient) WriteFile(path string, content io.ReadCloser, size int64) error {
+	return c.Client.WriteFile(path, failingReader{content}, size)
+}
+
+type failingReader struct {
+	io.ReadCloser
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("Connection reset")
+}
+
+func TestOneWayBackupOverwritten(t *testing.T) {
+	tests := []struct {
+		name     string
+		failing  bool
+		expected string
+		backedUp bool
+	}{
+		{name: "verified upload", expected: "new content", backedUp: true},
+		{name: "failed upload", failing: true, expected: "old"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in, out := newTestDir(t), newTestDir(t)
+			defer os.RemoveAll(in)
+			defer os.RemoveAll(out)
+			writeTestFiles(t, in, map[string]string{"/a": "new content"}, time.Time{})
+			writeTestFiles(t, out, map[string]string{"/a": "old"}, time.Time{})
+
+			output := newTestClient(out)
+			opt := OneWayOpt{BackupDir: "/.backup/", AttemptMax: 1}
+			var report SyncReport
+			if test.failing {
+				report = runTestOneWay(t, newTestClient(in), failingWriteClient{output}, opt)
+			} else {
+				report = runTestOneWay(t, newTestClient(in), output, opt)
+			}
+
+			files := readTestFiles(t, out)
+			if files["/a"] != test.expected {
+				t.Fatalf("output /a %q, expected %q", files["/a"], test.expected)
+			}
+			backups := 0
+			for path, content := range files {
+				if path != "/a" && content == "old" {
+					backups++
+				}
+			}
+			if backedUp := backups == 1; backedUp != test.backedUp || report.FilesBackedUp != backups {
+				t.Fatalf("backups %d, reported %d, expected backed up %t", backups, report.FilesBackedUp, test.backedUp)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+	"github.com/io-developer/go-davsync/pkg/util"
+)
+
+// OverwritePolicy decides what to do with files existing on both sides
+type OverwritePolicy string
+
+// Overwrite policies
+const (
+	OverwriteNever    = OverwritePolicy("Never")
+	OverwriteChanged  = OverwritePolicy("Changed")
+	OverwriteSize     = OverwritePolicy("SizeDiffers")
+	OverwriteNewer    = OverwritePolicy("Newer")
+	OverwriteChecksum = OverwritePolicy("ChecksumDiffers")
+	OverwriteAlways   = OverwritePolicy("Always")
+)
+
+// OverwritePolicies lists all known policies
+var OverwritePolicies = []OverwritePolicy{
+	OverwriteNever,
+	OverwriteChanged,
+	OverwriteSize,
+	OverwriteNewer,
+	OverwriteChecksum,
+	OverwriteAlways,
+}
+
+// IsValid reports whether the policy is known
+func (p OverwritePolicy) IsValid() bool {
+	for _, known := range OverwritePolicies {
+		if p == known {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *OneWay) compareResources(path string, input, output client.Resource) (overwrite bool, reason string) {
+	switch s.opt.Overwrite {
+	case OverwriteNever:
+		return false, "never overwrite"
+	case OverwriteAlways:
+		return true, "always overwrite"
+	case OverwriteSize:
+		return compareSize(input, output)
+	case OverwriteNewer:
+		return compareModTime(input, output, s.opt.ModifyWindow)
+	case OverwriteChecksum:
+		return s.compareChecksum(path, input, output)
+	}
+	return compareChanged(input, output, s.opt.ModifyWindow)
+}
+
+func compareSize(input, output client.Resource) (changed bool, reason string) {
+	if input.Size != output.Size {
+		return true, fmt.Sprintf("size differs (%d -> %d)", output.Size, input.Size)
+	}
+	return false, "size matched"
+}
+
+func compareModTime(input, output client.Resource, window time.Duration) (changed bool, reason string) {
+	if input.ModTime.Sub(output.ModTime) > window {
+		return true, fmt.Sprintf(
+			"input is newer (%s -> %s)",
+			output.ModTime.Format("2006-01-02 15:04:05"),
+			input.ModTime.Format("2006-01-02 15:04:05"),
+		)
+	}
+	return false, "input is not newer"
+}
+
+// compareChanged combines size, hashes and modification time
+func compareChanged(input, output client.Resource, window time.Duration) (changed bool, reason string) {
+	if changed, reason = compareSize(input, output); changed {
+		return
+	}
+	if matched, comparable := compareHashes(input, output); comparable {
+		if matched {
+			return false, "hash matched"
+		}
+		return true, "hash differs"
+	}
+	return compareModTime(input, output, window)
+}
+
+func (s *OneWay) compareChecksum(path string, input, output client.Resource) (changed bool, reason string) {
+	if output.IsLocal() {
+		hashed, err := hashResource(s.output, path, output, nil)
+		if err != nil {
+			return true, fmt.Sprintf("output hashing failed: %v", err)
+		}
+		output = hashed
+	}
+	if output.HashSha256 == "" && output.HashMd5 == "" && output.HashETag == "" {
+		changed, reason = compareSize(input, output)
+		return changed, "no output checksum, " + reason
+	}
+	hashed, err := s.hashInput(path, input)
+	if err != nil {
+		return true, fmt.Sprintf("input hashing failed: %v", err)
+	}
+	if matched, comparable := compareHashes(hashed, output); comparable {
+		if matched {
+			return false, "checksum matched"
+		}
+		return true, "checksum differs"
+	}
+	changed, reason = compareSize(input, output)
+	return changed, "no comparable checksum, " + reason
+}
+
+// compareHashes compares the strongest hash exposed by both resources.
+// ETags are opaque and server-specific, so they only count as a match
+func compareHashes(a, b client.Resource) (matched bool, comparable bool) {
+	if a.HashSha256 != "" && b.HashSha256 != "" {
+		return a.HashSha256 == b.HashSha256, true
+	}
+	if a.HashMd5 != "" && b.HashMd5 != "" {
+		return a.HashMd5 == b.HashMd5, true
+	}
+	if a.HashETag != "" && b.HashETag != "" && a.HashETag == b.HashETag {
+		return true, true
+	}
+	if a.HashETag != "" && b.MatchAnyHash(a.HashETag) {
+		return true, true
+	}
+	if b.HashETag != "" && a.MatchAnyHash(b.HashETag) {
+		return true, true
+	}
+	return false, false
+}
+
+func (s *OneWay) hashInput(path string, res client.Resource) (client.Resource, error) {
+	if res.IsLocal() {
+		return hashResource(s.input, path, res, nil)
+	}
+	return hashResource(s.input, path, res, s.opt.Limiter)
+}
+
+// hashResource fills MD5 and SHA256 of resource by reading it if needed.
+// Limiter may be nil
+func hashResource(c client.Client, path string, res client.Resource, limiter *util.Limiter) (client.Resource, error) {
+	if res.HashMd5 != "" && res.HashSha256 != "" {
+		return res, nil
+	}
+	if hasher, ok := c.(client.Hasher); ok {
+		return hasher.Hash(path, res)
+	}
+	fileReader, err := c.ReadFile(path)
+	if err != nil {
+		return res, err
+	}
+	if limiter != nil {
+		fileReader = util.NewLimitedReader(context.Background(), fileReader, limiter)
+	}
+	reader := util.NewRead(fileReader, res.Size)
+	defer reader.Close()
+
+	_, err = io.Copy(ioutil.Discard, reader)
+	if err != nil && !util.ErrorIsEOF(err) {
+		return res, err
+	}
+	if reader.GetBytesRead() != res.Size {
+		return res, fmt.Errorf(
+			"Hashing read %d of %d bytes, %s",
+			reader.GetBytesRead(),
+			res.Size,
+			path,
+		)
+	}
+	res.HashMd5 = reader.GetHashMd5()
+	res.HashSha256 = reader.GetHashSha256()
+	return res, nil
+}
@@ -0,0 +1,94 @@
+package synchronizer
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+)
+
+func md5Hex(content string) string {
+	sum := md5.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestCompareHashes(t *testing.T) {
+	tests := []struct {
+		name       string
+		a          client.Resource
+		b          client.Resource
+		matched    bool
+		comparable bool
+	}{
+		{"no hashes", client.Resource{}, client.Resource{}, false, false},
+		{"sha256 matched", client.Resource{HashSha256: "s", HashMd5: "x"}, client.Resource{HashSha256: "s", HashMd5: "y"}, true, true},
+		{"sha256 differs", client.Resource{HashSha256: "s1"}, client.Resource{HashSha256: "s2"}, false, true},
+		{"md5 matched", client.Resource{HashMd5: "m"}, client.Resource{HashMd5: "m", HashSha256: "s"}, true, true},
+		{"md5 differs", client.Resource{HashMd5: "m1"}, client.Resource{HashMd5: "m2"}, false, true},
+		{"same etags", client.Resource{HashETag: "e"}, client.Resource{HashETag: "e"}, true, true},
+		{"etags differ", client.Resource{HashETag: "e1"}, client.Resource{HashETag: "e2"}, false, false},
+		{"etag of md5", client.Resource{HashMd5: "m"}, client.Resource{HashETag: "m"}, true, true},
+		{"etag not of md5", client.Resource{HashMd5: "m"}, client.Resource{HashETag: "e"}, false, false},
+	}
+	for _, test := range tests {
+		matched, comparable := compareHashes(test.a, test.b)
+		if matched != test.matched || comparable != test.comparable {
+			t.Errorf("%s: matched %t comparable %t, expected %t %t", test.name, matched, comparable, test.matched, test.comparable)
+		}
+	}
+}
+
+func TestCompareResources(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+	writeTestFiles(t, dir, map[string]string{"/a": "abc"}, time.Time{})
+	abcMd5 := md5Hex("abc")
+
+	now := time.Now()
+	older := now.Add(-time.Minute)
+	tests := []struct {
+		name      string
+		policy    OverwritePolicy
+		window    time.Duration
+		input     client.Resource
+		output    client.Resource
+		overwrite bool
+	}{
+		{"never", OverwriteNever, 0, client.Resource{Size: 1}, client.Resource{Size: 2}, false},
+		{"always", OverwriteAlways, 0, client.Resource{Size: 1}, client.Resource{Size: 1}, true},
+
+		{"size differs", OverwriteSize, 0, client.Resource{Size: 1, ModTime: older}, client.Resource{Size: 2, ModTime: now}, true},
+		{"size matched", OverwriteSize, 0, client.Resource{Size: 1, ModTime: now}, client.Resource{Size: 1, ModTime: older}, false},
+
+		{"newer", OverwriteNewer, 0, client.Resource{Size: 1, ModTime: now}, client.Resource{Size: 1, ModTime: older}, true},
+		{"older", OverwriteNewer, 0, client.Resource{Size: 2, ModTime: older}, client.Resource{Size: 1, ModTime: now}, false},
+		{"newer within window", OverwriteNewer, 2 * time.Minute, client.Resource{ModTime: now}, client.Resource{ModTime: older}, false},
+
+		{"changed size", OverwriteChanged, 0, client.Resource{Size: 1, ModTime: now}, client.Resource{Size: 2, ModTime: now}, true},
+		{"changed hash", OverwriteChanged, 0, client.Resource{Size: 1, HashMd5: "m1"}, client.Resource{Size: 1, HashMd5: "m2"}, true},
+		{"hash matched, newer", OverwriteChanged, 0, client.Resource{Size: 1, HashMd5: "m", ModTime: now}, client.Resource{Size: 1, HashMd5: "m", ModTime: older}, false},
+		{"no hashes, newer", OverwriteChanged, 0, client.Resource{Size: 1, ModTime: now}, client.Resource{Size: 1, ModTime: older}, true},
+		{"no hashes, newer within window", OverwriteChanged, 2 * time.Minute, client.Resource{Size: 1, ModTime: now}, client.Resource{Size: 1, ModTime: older}, false},
+		{"opaque etag, newer", OverwriteChanged, 0, client.Resource{Size: 1, HashMd5: "m", ModTime: now}, client.Resource{Size: 1, HashETag: "e", ModTime: older}, true},
+
+		{"checksum matched", OverwriteChecksum, 0, client.Resource{Size: 3, ModTime: now}, client.Resource{Size: 3, HashMd5: abcMd5}, false},
+		{"checksum differs", OverwriteChecksum, 0, client.Resource{Size: 3}, client.Resource{Size: 3, HashMd5: md5Hex("xyz")}, true},
+		{"checksum of etag", OverwriteChecksum, 0, client.Resource{Size: 3}, client.Resource{Size: 3, HashETag: abcMd5}, false},
+		{"no comparable checksum, same size", OverwriteChecksum, 0, client.Resource{Size: 3, ModTime: now}, client.Resource{Size: 3, HashETag: "e", ModTime: older}, false},
+		{"no comparable checksum, size differs", OverwriteChecksum, 0, client.Resource{Size: 3}, client.Resource{Size: 4, HashETag: "e"}, true},
+		{"no output checksum", OverwriteChecksum, 0, client.Resource{Size: 3, ModTime: now}, client.Resource{Size: 3, ModTime: older}, false},
+	}
+	for _, test := range tests {
+		s := &OneWay{
+			opt:   OneWayOpt{Overwrite: test.policy, ModifyWindow: test.window},
+			input: newTestClient(dir),
+		}
+		overwrite, reason := s.compareResources("/a", test.input, test.output)
+		if overwrite != test.overwrite {
+			t.Errorf("%s: overwrite %t (%s), expected %t", test.name, overwrite, reason, test.overwrite)
+		}
+	}
+}
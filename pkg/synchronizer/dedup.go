@@ -0,0 +1,251 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+	"github.com/io-developer/go-davsync/pkg/util"
+)
+
+// contentIndex finds files by content hash. Local files without known
+// hashes are hashed only when a new file of the same size shows up
+type contentIndex struct {
+	c        client.Client
+	tree     *client.TreeBuffer
+	bySha256 map[string]client.Resource
+	byMd5    map[string]client.Resource
+	sizes    map[int64]bool
+	unhashed map[int64][]string
+	logFn    func(string)
+}
+
+func newContentIndex(c client.Client, tree *client.TreeBuffer, logFn func(string)) *contentIndex {
+	return &contentIndex{
+		c:        c,
+		tree:     tree,
+		bySha256: map[string]client.Resource{},
+		byMd5:    map[string]client.Resource{},
+		sizes:    map[int64]bool{},
+		unhashed: map[int64][]string{},
+		logFn:    logFn,
+	}
+}
+
+// add indexes file, false if it has no hash and can not be hashed cheaply
+func (idx *contentIndex) add(path string, res client.Resource) bool {
+	res.Path = path
+	if res.HashSha256 == "" && res.HashMd5 == "" {
+		if !res.IsLocal() {
+			return false
+		}
+		idx.unhashed[res.Size] = append(idx.unhashed[res.Size], path)
+		idx.sizes[res.Size] = true
+		return true
+	}
+	if _, exists := idx.bySha256[res.HashSha256]; !exists && res.HashSha256 != "" {
+		idx.bySha256[res.HashSha256] = res
+	}
+	if _, exists := idx.byMd5[res.HashMd5]; !exists && res.HashMd5 != "" {
+		idx.byMd5[res.HashMd5] = res
+	}
+	idx.sizes[res.Size] = true
+	return true
+}
+
+// hasSize reports whether any indexed file may match content of this size
+func (idx *contentIndex) hasSize(size int64) bool {
+	return idx.sizes[size]
+}
+
+// find returns indexed file with the same content as hashed input
+func (idx *contentIndex) find(input client.Resource) (client.Resource, bool) {
+	for _, path := range idx.unhashed[input.Size] {
+		res, _ := idx.tree.GetChild(path)
+		res, err := hashResource(idx.c, path, res, nil)
+		if err != nil {
+			idx.logFn(fmt.Sprintf("COPY? %s hashing error: %v", path, err))
+			continue
+		}
+		idx.add(path, res)
+	}
+	delete(idx.unhashed, input.Size)
+
+	for _, match := range []struct {
+		hash  string
+		index map[string]client.Resource
+	}{
+		{input.HashSha256, idx.bySha256},
+		{input.HashMd5, idx.byMd5},
+	} {
+		if match.hash == "" {
+			continue
+		}
+		if res, exists := match.index[match.hash]; exists && res.Size == input.Size {
+			return res, true
+		}
+	}
+	return client.Resource{}, false
+}
+
+// calcCopies matches new input files against content already on output,
+// or uploaded by this run, by SHA256 or MD5. Such files are copied
+// server-side after uploads instead of uploading. Output files without
+// checksums are known by hashes kept in manifest only
+func (s *OneWay) calcCopies() {
+	s.copies = map[string]string{}
+	if !s.opt.Dedup {
+		return
+	}
+	s.log("Detecting duplicates...")
+
+	// moved away or overwritten before copying
+	skipped := map[string]bool{}
+	for _, src := range s.moves {
+		skipped[src] = true
+	}
+	for _, path := range s.changedPaths {
+		skipped[path] = true
+	}
+	index := newContentIndex(s.output, s.outputTree, s.log)
+	outputFiles, indexed := 0, 0
+	for _, path := range util.PathSorted(s.outputTree.GetChildrenPaths()) {
+		res, _ := s.outputTree.GetChild(path)
+		if res.IsDir || res.Size == 0 || skipped[path] {
+			continue
+		}
+		outputFiles++
+		if index.add(path, res) {
+			indexed++
+		}
+	}
+	if indexed < outputFiles {
+		s.log(fmt.Sprintf(
+			"Dedup: %d of %d output files expose no checksum and are not known by manifest, they are not copied",
+			outputFiles-indexed,
+			outputFiles,
+		))
+	}
+
+	addSizes := map[int64]int{}
+	for _, path := range s.addPaths {
+		if res, _ := s.inputTree.GetChild(path); !res.IsDir {
+			addSizes[res.Size]++
+		}
+	}
+	for _, addPath := range util.PathSorted(s.addPaths) {
+		input, _ := s.inputTree.GetChild(addPath)
+		if _, isMoved := s.moves[addPath]; isMoved || input.IsDir || input.Size == 0 {
+			continue
+		}
+		if !index.hasSize(input.Size) && addSizes[input.Size] < 2 {
+			continue
+		}
+		input, err := s.hashInput(addPath, input)
+		if err != nil {
+			s.log(fmt.Sprintf("COPY? %s hashing error: %v", addPath, err))
+			continue
+		}
+		// keep hashes for the copy check
+		s.inputTree.SetChild(addPath, input)
+		src, found := index.find(input)
+		if !found {
+			// uploaded by this run, next files of the same content copy it
+			index.add(addPath, input)
+			continue
+		}
+		s.copies[addPath] = src.Path
+		s.log(fmt.Sprintf("COPY %s -> %s", src.Path, addPath))
+	}
+}
+
+// rememberUploaded keeps hashes of content put in place by this run
+func (s *OneWay) rememberUploaded(path string, res client.Resource) {
+	s.uploadedMu.Lock()
+	defer s.uploadedMu.Unlock()
+	if s.uploaded == nil {
+		s.uploaded = map[string]client.Resource{}
+	}
+	s.uploaded[path] = res
+}
+
+func (s *OneWay) uploadedHashes(path string) (res client.Resource, exists bool) {
+	s.uploadedMu.Lock()
+	defer s.uploadedMu.Unlock()
+	res, exists = s.uploaded[path]
+	return
+}
+
+// hashedContent is input content known by its hashes
+type hashedContent client.Resource
+
+func (c hashedContent) IsComplete() bool {
+	return true
+}
+
+func (c hashedContent) GetBytesRead() int64 {
+	return c.Size
+}
+
+func (c hashedContent) GetBytesTotal() int64 {
+	return c.Size
+}
+
+func (c hashedContent) GetHashMd5() string {
+	return c.HashMd5
+}
+
+func (c hashedContent) GetHashSha256() string {
+	return c.HashSha256
+}
+
+func (s *OneWay) copyOutputFile(ctx context.Context, path string, logFn func(string)) error {
+	srcPath, exists := s.copySources[path]
+	if !exists {
+		return fmt.Errorf("Copy source not found for '%s'", path)
+	}
+	_, inOutput := s.outputTree.GetChild(srcPath)
+	_, uploaded := s.uploadedHashes(srcPath)
+	if !inOutput && !uploaded {
+		logFn("Source not exists. Uploading..")
+		return s.uploadFile(ctx, path, logFn)
+	}
+	res, exists := s.inputTree.GetChild(path)
+	if !exists {
+		logFn("Not exists. Skiping..")
+		return nil
+	}
+	res, err := s.hashInput(path, res)
+	if err != nil {
+		return err
+	}
+	logFn(fmt.Sprintf("Copying from %s", srcPath))
+	err = s.output.CopyFile(srcPath, path)
+	if err != nil {
+		logFn(fmt.Sprintf("Copy failed '%v'. Uploading..", err))
+		return s.uploadFile(ctx, path, logFn)
+	}
+	copied, exists, err := s.output.ReadResource(path)
+	if err == nil && exists && copied.HashMd5 == "" && copied.HashSha256 == "" {
+		s.log(fmt.Sprintf("COPY %s is checked by size only, output exposes no checksum", path))
+	}
+	err = s.checkUploaded(ctx, path, res, hashedContent(res), logFn)
+	s.emit(VerifyEvent{
+		EventBase:  newEventBase(),
+		Path:       path,
+		UploadPath: path,
+		Size:       res.Size,
+		HashMd5:    res.HashMd5,
+		HashSha256: res.HashSha256,
+		Err:        err,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		logFn(fmt.Sprintf("Copy check failed '%v'. Uploading..", err))
+		return s.uploadFile(ctx, path, logFn)
+	}
+	s.emit(CopyEvent{EventBase: newEventBase(), Src: srcPath, Path: path, Size: res.Size})
+	return s.afterUpload(path, res, logFn)
+}
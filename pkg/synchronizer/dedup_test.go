@@ -0,0 +1,109 @@
+package synchronizer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+)
+
+func TestCalcCopies(t *testing.T) {
+	tests := []struct {
+		name   string
+		moves  bool
+		input  map[string]string
+		output map[string]string
+		copies map[string]string
+	}{
+		{
+			name:   "content on output",
+			input:  map[string]string{"/a": "content", "/b": "content"},
+			output: map[string]string{"/a": "content"},
+			copies: map[string]string{"/b": "/a"},
+		},
+		{
+			name:   "content uploaded by this run",
+			input:  map[string]string{"/a": "content", "/b": "content", "/c": "content"},
+			copies: map[string]string{"/b": "/a", "/c": "/a"},
+		},
+		{
+			name:   "same size, other content",
+			input:  map[string]string{"/a": "content", "/b": "CONTENT"},
+			copies: map[string]string{},
+		},
+		{
+			name:   "empty files",
+			input:  map[string]string{"/a": "", "/b": ""},
+			copies: map[string]string{},
+		},
+		{
+			name:   "ambiguous move source",
+			moves:  true,
+			input:  map[string]string{"/new1": "content", "/new2": "content"},
+			output: map[string]string{"/old": "content"},
+			copies: map[string]string{"/new1": "/old", "/new2": "/old"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in, out := newTestDir(t), newTestDir(t)
+			defer os.RemoveAll(in)
+			defer os.RemoveAll(out)
+			writeTestFiles(t, in, test.input, time.Time{})
+			writeTestFiles(t, out, test.output, time.Time{})
+
+			opt := OneWayOpt{Dedup: true, DetectMoves: test.moves, AllowDelete: test.moves}
+			plan := planTestOneWay(t, newTestClient(in), newTestClient(out), opt)
+			expectPlanSources(t, "copies", plan.Copies, test.copies)
+			if len(plan.Moves) > 0 {
+				t.Fatalf("unexpected moves %v", planItemSources(plan.Moves))
+			}
+
+			report := runTestOneWay(t, newTestClient(in), newTestClient(out), opt)
+			if report.FilesCopied != len(test.copies) {
+				t.Fatalf("copied %d, expected %d", report.FilesCopied, len(test.copies))
+			}
+			expectTestFiles(t, out, test.input)
+		})
+	}
+}
+
+func TestCalcCopiesManifestHashes(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest bool
+		copies   map[string]string
+	}{
+		{name: "hashes of manifest", manifest: true, copies: map[string]string{"/b": "/a"}},
+		{name: "no checksum without manifest", copies: map[string]string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in, out := newTestDir(t), newTestDir(t)
+			defer os.RemoveAll(in)
+			defer os.RemoveAll(out)
+			manifestDir := newTestDir(t)
+			defer os.RemoveAll(manifestDir)
+
+			output := &remoteTestClient{
+				Client: newTestClient(out),
+				etag: func(path string, res client.Resource) string {
+					return fmt.Sprintf("%d-%d", res.Size, res.ModTime.UnixNano())
+				},
+			}
+			opt := OneWayOpt{Dedup: true}
+			if test.manifest {
+				opt.ManifestPath = filepath.Join(manifestDir, "manifest.json")
+			}
+			writeTestFiles(t, in, map[string]string{"/a": "content"}, time.Time{})
+			runTestOneWay(t, newTestClient(in), output, opt)
+
+			writeTestFiles(t, in, map[string]string{"/b": "content"}, time.Time{})
+			plan := planTestOneWay(t, newTestClient(in), output, opt)
+			expectPlanSources(t, "copies", plan.Copies, test.copies)
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package synchronizer
+
+import (
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+)
+
+// EventHandler receives events of OneWay sync. It is called synchronously
+// from sync threads, possibly concurrently, so it must be quick and safe
+type EventHandler interface {
+	HandleEvent(event Event)
+}
+
+// EventHandlerFunc adapts a func to EventHandler
+type EventHandlerFunc func(event Event)
+
+func (f EventHandlerFunc) HandleEvent(event Event) {
+	f(event)
+}
+
+// Event is one of ...Event types of this package, switch on its type
+type Event interface {
+	EventTime() time.Time
+}
+
+// EventBase is embedded by all events
+type EventBase struct {
+	Time time.Time
+}
+
+func (e EventBase) EventTime() time.Time {
+	return e.Time
+}
+
+func newEventBase() EventBase {
+	return EventBase{Time: time.Now()}
+}
+
+// TreeSide tells which tree is read
+type TreeSide string
+
+// Tree sides
+const (
+	TreeInput  = TreeSide("Input")
+	TreeOutput = TreeSide("Output")
+)
+
+type TreeReadStartEvent struct {
+	EventBase
+	Side TreeSide
+}
+
+// TreeReadFinishEvent counts paths left after filters
+type TreeReadFinishEvent struct {
+	EventBase
+	Side  TreeSide
+	Files int
+	Dirs  int
+	Err   error
+}
+
+type PlanEvent struct {
+	EventBase
+	Plan Plan
+}
+
+// FileStartEvent is sent on every attempt, Size is known for uploads only
+type FileStartEvent struct {
+	EventBase
+	Op      PlanOp
+	Path    string
+	Size    int64
+	Attempt uint
+}
+
+// ProgressEvent is sent on every read of uploaded content
+type ProgressEvent struct {
+	EventBase
+	Path       string
+	BytesRead  int64
+	BytesTotal int64
+}
+
+// VerifyEvent is a check of uploaded file against sent content
+type VerifyEvent struct {
+	EventBase
+	Path       string
+	UploadPath string
+	Size       int64
+	HashMd5    string
+	HashSha256 string
+	Err        error
+}
+
+type MoveEvent struct {
+	EventBase
+	Src  string
+	Path string
+	Size int64
+}
+
+// CopyEvent is sent once duplicate content is copied on output and checked
+type CopyEvent struct {
+	EventBase
+	Src  string
+	Path string
+	Size int64
+}
+
+// DeleteEvent is sent once output file or dir is gone, moved to backup dir if BackedUp
+type DeleteEvent struct {
+	EventBase
+	Path     string
+	IsDir    bool
+	Size     int64
+	BackedUp bool
+}
+
+// FileFinishEvent is sent after the last attempt
+type FileFinishEvent struct {
+	EventBase
+	Op       PlanOp
+	Path     string
+	Attempts uint
+	Err      error
+}
+
+type SyncFinishEvent struct {
+	EventBase
+	Report SyncReport
+}
+
+func (s *OneWay) emit(event Event) {
+	if s.opt.Events != nil {
+		s.opt.Events.HandleEvent(event)
+	}
+}
+
+func (s *OneWay) emitTreeRead(side TreeSide, tree *client.TreeBuffer, err error) {
+	if s.opt.Events == nil {
+		return
+	}
+	event := TreeReadFinishEvent{EventBase: newEventBase(), Side: side, Err: err}
+	for _, res := range tree.GetChildren() {
+		if res.IsDir {
+			event.Dirs++
+		} else {
+			event.Files++
+		}
+	}
+	s.emit(event)
+}
@@ -0,0 +1,79 @@
+package synchronizer
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOneWayEvents(t *testing.T) {
+	in, out := newTestDir(t), newTestDir(t)
+	defer os.RemoveAll(in)
+	defer os.RemoveAll(out)
+	writeTestFiles(t, in, map[string]string{"/sub/a": "a"}, time.Time{})
+	writeTestFiles(t, out, map[string]string{"/old": "old"}, time.Time{})
+
+	mu := sync.Mutex{}
+	kinds := []string{}
+	var finish FileFinishEvent
+	var report SyncReport
+	handler := EventHandlerFunc(func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		if event.EventTime().IsZero() {
+			t.Errorf("%T without time", event)
+		}
+		switch e := event.(type) {
+		case TreeReadStartEvent:
+			kinds = append(kinds, "TreeReadStart")
+		case TreeReadFinishEvent:
+			kinds = append(kinds, fmt.Sprintf("TreeReadFinish %s %d/%d", e.Side, e.Files, e.Dirs))
+		case PlanEvent:
+			kinds = append(kinds, fmt.Sprintf("Plan %d", len(e.Plan.Items())))
+		case FileStartEvent:
+			kinds = append(kinds, fmt.Sprintf("FileStart %s %s", e.Op, e.Path))
+		case VerifyEvent:
+			kinds = append(kinds, fmt.Sprintf("Verify %s", e.Path))
+		case DeleteEvent:
+			kinds = append(kinds, fmt.Sprintf("Delete %s", e.Path))
+		case FileFinishEvent:
+			kinds = append(kinds, fmt.Sprintf("FileFinish %s %s", e.Op, e.Path))
+			if e.Op == PlanUpload {
+				finish = e
+			}
+		case SyncFinishEvent:
+			kinds = append(kinds, "SyncFinish")
+			report = e.Report
+		}
+	})
+	runTestOneWay(t, newTestClient(in), newTestClient(out), OneWayOpt{AllowDelete: true, Events: handler})
+
+	expected := map[string]bool{
+		"TreeReadFinish Input 1/2":  true,
+		"TreeReadFinish Output 1/1": true,
+		"Plan 3":                    true,
+		"FileStart Upload /sub/a":   true,
+		"Verify /sub/a":             true,
+		"FileFinish Upload /sub/a":  true,
+		"FileStart Delete /old":     true,
+		"Delete /old":               true,
+		"FileFinish Delete /old":    true,
+	}
+	for _, kind := range kinds {
+		delete(expected, kind)
+	}
+	if len(expected) > 0 {
+		t.Fatalf("missing events %v of %v", expected, kinds)
+	}
+	if kinds[0] != "TreeReadStart" || kinds[len(kinds)-1] != "SyncFinish" {
+		t.Fatalf("events %v, expected to start with tree read and end with sync finish", kinds)
+	}
+	if finish.Attempts != 1 || finish.Err != nil {
+		t.Fatalf("upload finished after %d attempts, err %v", finish.Attempts, finish.Err)
+	}
+	if report.FilesUploaded != 1 || report.FilesDeleted != 1 {
+		t.Fatalf("reported %d uploads, %d deletes", report.FilesUploaded, report.FilesDeleted)
+	}
+}
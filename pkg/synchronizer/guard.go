@@ -0,0 +1,70 @@
+package synchronizer
+
+import (
+	"fmt"
+)
+
+// CheckDeletes refuses plans deleting too much of output: when input tree is
+// empty or unreadable, or when MaxDelete or MaxDeletePercent are exceeded.
+// Force disables the checks
+func (s *OneWay) CheckDeletes(plan Plan) error {
+	return s.checkDeleteCount(len(plan.Deletes) + len(plan.DeleteDirs))
+}
+
+// checkMoveDelete counts move source left by fallback upload as one more
+// delete of the executed plan
+func (s *OneWay) checkMoveDelete() error {
+	s.guardMu.Lock()
+	defer s.guardMu.Unlock()
+	s.guardDeletes++
+	return s.checkDeleteCount(s.guardDeletes)
+}
+
+func (s *OneWay) checkDeleteCount(deletes int) error {
+	if s.opt.Force || deletes == 0 {
+		return nil
+	}
+	if s.inputReadFailed {
+		return fmt.Errorf("Refusing to delete %d output paths: input tree is unreadable, force is required", deletes)
+	}
+	if countPaths(s.inputTree.GetChildrenPaths()) == 0 {
+		return fmt.Errorf("Refusing to delete %d output paths: input tree is empty, force is required", deletes)
+	}
+	if s.opt.MaxDelete > 0 && deletes > s.opt.MaxDelete {
+		return fmt.Errorf("Refusing to delete %d output paths: max %d allowed, force is required", deletes, s.opt.MaxDelete)
+	}
+	total := s.outputPathCount()
+	if s.opt.MaxDeletePercent > 0 && total > 0 {
+		percent := 100 * float64(deletes) / float64(total)
+		if percent > s.opt.MaxDeletePercent {
+			return fmt.Errorf(
+				"Refusing to delete %d of %d output paths (%.1f%%): max %.1f%% allowed, force is required",
+				deletes,
+				total,
+				percent,
+				s.opt.MaxDeletePercent,
+			)
+		}
+	}
+	return nil
+}
+
+// countPaths counts tree paths except root
+func countPaths(paths []string) int {
+	count := 0
+	for _, path := range paths {
+		if path != "/" {
+			count++
+		}
+	}
+	return count
+}
+
+// outputPathCount counts output paths. Partial output tree of resumed run is
+// replaced by the count journaled at the beginning
+func (s *OneWay) outputPathCount() int {
+	if !s.outputTreeRead && s.journal != nil && s.journal.outputPaths > 0 {
+		return s.journal.outputPaths
+	}
+	return countPaths(s.outputTree.GetChildrenPaths())
+}
@@ -0,0 +1,147 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+)
+
+func newTestTree(count int) *client.TreeBuffer {
+	children := map[string]client.Resource{"/": {Path: "/", IsDir: true}}
+	for i := 0; i < count; i++ {
+		path := fmt.Sprintf("/%d", i)
+		children[path] = client.Resource{Path: path}
+	}
+	tree := client.NewTreeBuffer(nil)
+	tree.Load(children)
+	return tree
+}
+
+func TestCheckDeletes(t *testing.T) {
+	tests := []struct {
+		name       string
+		opt        OneWayOpt
+		inputs     int
+		outputs    int
+		readFailed bool
+		deletes    int
+		dirDeletes int
+		wantErr    bool
+	}{
+		{name: "nothing to delete", inputs: 0, outputs: 10},
+		{name: "empty input", inputs: 0, outputs: 10, deletes: 10, wantErr: true},
+		{name: "unreadable input", inputs: 5, outputs: 10, readFailed: true, deletes: 5, wantErr: true},
+		{name: "forced empty input", opt: OneWayOpt{Force: true}, inputs: 0, outputs: 10, deletes: 10},
+		{name: "no limits", inputs: 1, outputs: 10, deletes: 9},
+		{name: "max delete", opt: OneWayOpt{MaxDelete: 3}, inputs: 5, outputs: 10, deletes: 3},
+		{name: "max delete exceeded", opt: OneWayOpt{MaxDelete: 3}, inputs: 5, outputs: 10, deletes: 2, dirDeletes: 2, wantErr: true},
+		{name: "max percent", opt: OneWayOpt{MaxDeletePercent: 50}, inputs: 5, outputs: 10, deletes: 5},
+		{name: "max percent exceeded", opt: OneWayOpt{MaxDeletePercent: 50}, inputs: 5, outputs: 10, deletes: 6, wantErr: true},
+		{name: "forced limits", opt: OneWayOpt{MaxDelete: 1, MaxDeletePercent: 10, Force: true}, inputs: 5, outputs: 10, deletes: 6},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &OneWay{
+				opt:             test.opt,
+				inputTree:       newTestTree(test.inputs),
+				outputTree:      newTestTree(test.outputs),
+				inputReadFailed: test.readFailed,
+			}
+			plan := Plan{}
+			for i := 0; i < test.deletes; i++ {
+				plan.Deletes = append(plan.Deletes, PlanItem{Op: PlanDelete, Path: fmt.Sprintf("/%d", i)})
+			}
+			for i := 0; i < test.dirDeletes; i++ {
+				plan.DeleteDirs = append(plan.DeleteDirs, PlanItem{Op: PlanDeleteDir, Path: fmt.Sprintf("/d%d/", i)})
+			}
+			err := s.CheckDeletes(plan)
+			if test.wantErr && err == nil {
+				t.Fatal("expected error")
+			}
+			if !test.wantErr && err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckMoveDelete(t *testing.T) {
+	s := &OneWay{
+		opt:          OneWayOpt{MaxDelete: 3},
+		inputTree:    newTestTree(5),
+		outputTree:   newTestTree(10),
+		guardDeletes: 2,
+	}
+	if err := s.checkMoveDelete(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := s.checkMoveDelete(); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestResumeChecksDeletes(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   map[string]string
+		opt     OneWayOpt
+		output  map[string]string
+		aborted bool
+	}{
+		{
+			name:    "empty input",
+			input:   map[string]string{},
+			output:  map[string]string{"/a": "a", "/b": "b", "/c": "c"},
+			aborted: true,
+		},
+		{
+			name:   "percent of journaled output",
+			input:  map[string]string{"/c": "c"},
+			opt:    OneWayOpt{MaxDeletePercent: 50},
+			output: map[string]string{"/c": "c"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in, out := newTestDir(t), newTestDir(t)
+			defer os.RemoveAll(in)
+			defer os.RemoveAll(out)
+			writeTestFiles(t, in, test.input, time.Time{})
+			writeTestFiles(t, out, map[string]string{"/a": "a", "/b": "b", "/c": "c"}, time.Time{})
+
+			journalPath := filepath.Join(newTestDir(t), "journal")
+			defer os.RemoveAll(filepath.Dir(journalPath))
+			input, output := newTestClient(in), newTestClient(out)
+			plan := Plan{Deletes: []PlanItem{
+				{Op: PlanDelete, Path: "/a", Size: 1},
+				{Op: PlanDelete, Path: "/b", Size: 1},
+			}}
+			j, err := createJournal(journalPath, input.ToAbsPath("/"), output.ToAbsPath("/"), 10, plan)
+			if err != nil {
+				t.Fatal(err)
+			}
+			j.close()
+
+			opt := test.opt
+			opt.ThreadCount = 2
+			opt.AllowDelete = true
+			opt.JournalPath = journalPath
+			errors := make(chan error)
+			go func() {
+				for range errors {
+				}
+			}()
+			report := NewOneWay(input, output, opt).Resume(context.Background(), errors)
+			close(errors)
+			if aborted := report.State == ReportAborted; aborted != test.aborted {
+				t.Fatalf("aborted %t, expected %t", aborted, test.aborted)
+			}
+			expectTestFiles(t, out, test.output)
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package synchronizer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+)
+
+// JournalType is a kind of journal record
+type JournalType string
+
+// Journal record types
+const (
+	JournalBegin    = JournalType("Begin")
+	JournalPlan     = JournalType("Plan")
+	JournalUpload   = JournalType("Upload")
+	JournalVerified = JournalType("Verified")
+	JournalDone     = JournalType("Done")
+)
+
+// JournalRecord is a single line of write-ahead journal
+type JournalRecord struct {
+	Time       time.Time
+	Type       JournalType
+	Op         PlanOp `json:",omitempty"`
+	Path       string `json:",omitempty"`
+	Src        string `json:",omitempty"`
+	Size       int64  `json:",omitempty"`
+	UploadPath string `json:",omitempty"`
+	HashMd5    string `json:",omitempty"`
+	HashSha256 string `json:",omitempty"`
+	Input      string `json:",omitempty"`
+	Output     string `json:",omitempty"`
+	// OutputPaths is count of output paths at the beginning, for delete guard
+	OutputPaths int `json:",omitempty"`
+}
+
+func (r JournalRecord) GetBytesRead() int64 {
+	return r.Size
+}
+
+func (r JournalRecord) GetHashMd5() string {
+	return r.HashMd5
+}
+
+func (r JournalRecord) GetHashSha256() string {
+	return r.HashSha256
+}
+
+// journal appends records to file, syncing each one to disk
+type journal struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	done    map[string]bool
+	uploads map[string]JournalRecord
+
+	outputPaths int
+}
+
+func journalKey(op PlanOp, path string) string {
+	return string(op) + ":" + path
+}
+
+// createJournal starts new journal with the whole plan
+func createJournal(path, inputBase, outputBase string, outputPaths int, plan Plan) (*journal, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j := &journal{
+		path:    path,
+		file:    file,
+		done:    map[string]bool{},
+		uploads: map[string]JournalRecord{},
+	}
+	records := []JournalRecord{{
+		Time:        time.Now(),
+		Type:        JournalBegin,
+		Input:       inputBase,
+		Output:      outputBase,
+		OutputPaths: outputPaths,
+	}}
+	for _, item := range plan.Items() {
+		records = append(records, JournalRecord{
+			Time: time.Now(),
+			Type: JournalPlan,
+			Op:   item.Op,
+			Path: item.Path,
+			Src:  item.Src,
+			Size: item.Size,
+		})
+	}
+	err = j.write(records...)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// openJournal reads existing journal and returns not yet done part of plan.
+// Truncated last line of crashed process is ignored
+func openJournal(path, inputBase, outputBase string) (*journal, Plan, error) {
+	plan := Plan{
+		MakeDirs:   []PlanItem{},
+		Moves:      []PlanItem{},
+		Uploads:    []PlanItem{},
+		Copies:     []PlanItem{},
+		Deletes:    []PlanItem{},
+		DeleteDirs: []PlanItem{},
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, plan, err
+	}
+	j := &journal{
+		path:    path,
+		done:    map[string]bool{},
+		uploads: map[string]JournalRecord{},
+	}
+	items := []PlanItem{}
+	begun := false
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		rec := JournalRecord{}
+		if json.Unmarshal(scanner.Bytes(), &rec) != nil {
+			continue
+		}
+		switch rec.Type {
+		case JournalBegin:
+			if rec.Input != inputBase || rec.Output != outputBase {
+				file.Close()
+				return nil, plan, fmt.Errorf(
+					"Journal '%s' belongs to other dirs (%s -> %s), expected (%s -> %s)",
+					path,
+					rec.Input,
+					rec.Output,
+					inputBase,
+					outputBase,
+				)
+			}
+			begun = true
+			j.outputPaths = rec.OutputPaths
+		case JournalPlan:
+			items = append(items, PlanItem{Op: rec.Op, Path: rec.Path, Src: rec.Src, Size: rec.Size})
+		case JournalUpload, JournalVerified:
+			j.uploads[rec.Path] = rec
+		case JournalDone:
+			j.done[journalKey(rec.Op, rec.Path)] = true
+		}
+	}
+	file.Close()
+	if err = scanner.Err(); err != nil {
+		return nil, plan, err
+	}
+	if !begun {
+		return nil, plan, fmt.Errorf("Journal '%s' has no beginning", path)
+	}
+
+	for _, item := range items {
+		if j.done[journalKey(item.Op, item.Path)] {
+			continue
+		}
+		switch item.Op {
+		case PlanMakeDir:
+			plan.MakeDirs = append(plan.MakeDirs, item)
+		case PlanMove:
+			plan.Moves = append(plan.Moves, item)
+		case PlanCopy:
+			plan.Copies = append(plan.Copies, item)
+		case PlanUpload:
+			plan.Uploads = append(plan.Uploads, item)
+		case PlanDelete:
+			plan.Deletes = append(plan.Deletes, item)
+		case PlanDeleteDir:
+			plan.DeleteDirs = append(plan.DeleteDirs, item)
+		}
+	}
+
+	j.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, plan, err
+	}
+	return j, plan, nil
+}
+
+func (j *journal) write(records ...JournalRecord) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	buf := []byte{}
+	for _, rec := range records {
+		bytes, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, bytes...), '\n')
+	}
+	if _, err := j.file.Write(buf); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+func (j *journal) lastUpload(path string) (rec JournalRecord, exists bool) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	rec, exists = j.uploads[path]
+	return
+}
+
+func (j *journal) close() error {
+	if j == nil {
+		return nil
+	}
+	return j.file.Close()
+}
+
+// Resume continues plan of interrupted run from journal. Input tree is read,
+// output one is taken from the plan and files to overwrite
+func (s *OneWay) Resume(ctx context.Context, errors chan<- error) SyncReport {
+	s.bind(ctx)
+
+	s.report = newSyncReport()
+	timeStart := time.Now()
+
+	j, plan, err := openJournal(s.opt.JournalPath, s.input.ToAbsPath("/"), s.output.ToAbsPath("/"))
+	if err != nil {
+		errors <- err
+		s.report.addError("ReadJournal", "", err)
+		s.report.finish(ctx, false)
+		LogReport(s.report, s.log)
+		s.emit(SyncFinishEvent{EventBase: newEventBase(), Report: s.report})
+		return s.report
+	}
+	s.journal = j
+	s.log(fmt.Sprintf("Journal: resuming, %d operations left", len(plan.Items())))
+
+	s.emit(TreeReadStartEvent{EventBase: newEventBase(), Side: TreeInput})
+	err = s.inputTree.Read()
+	if err != nil {
+		s.reportError("ReadInput", "", err)
+		errors <- err
+	}
+	s.inputReadFailed = err != nil
+	s.emitTreeRead(TreeInput, s.inputTree, err)
+	plan.Deletes = s.stillDeleted(plan.Deletes)
+	plan.DeleteDirs = s.stillDeleted(plan.DeleteDirs)
+
+	outputChildren := map[string]client.Resource{}
+	for _, item := range plan.Deletes {
+		outputChildren[item.Path] = client.Resource{Path: item.Path, Size: item.Size}
+	}
+	for _, item := range plan.DeleteDirs {
+		outputChildren[item.Path] = client.Resource{Path: item.Path, IsDir: true}
+	}
+	for _, item := range plan.Uploads {
+		// overwritten files must be known to be backed up
+		res, exists, err := s.output.ReadResource(item.Path)
+		if err != nil {
+			s.reportError("ReadOutput", item.Path, err)
+			errors <- err
+		}
+		if exists {
+			outputChildren[item.Path] = res
+		}
+	}
+	for _, item := range plan.Moves {
+		outputChildren[item.Src] = client.Resource{Path: item.Src, Size: item.Size}
+	}
+	for _, item := range plan.Copies {
+		if _, exists := outputChildren[item.Src]; !exists {
+			outputChildren[item.Src] = client.Resource{Path: item.Src, Size: item.Size}
+		}
+	}
+	s.outputTree.Load(outputChildren)
+	s.outputTreeRead = false // partial tree must not become manifest
+	s.emit(PlanEvent{EventBase: newEventBase(), Plan: plan})
+
+	s.report.PlanDuration = time.Now().Sub(timeStart)
+	return s.Execute(ctx, plan, errors)
+}
+
+// stillDeleted drops journaled deletes of paths back in input. Nothing is
+// deleted when input is unreadable
+func (s *OneWay) stillDeleted(items []PlanItem) []PlanItem {
+	kept := []PlanItem{}
+	for _, item := range items {
+		if s.inputReadFailed {
+			s.log(fmt.Sprintf("Journal: input is unreadable, keeping %s", item.Path))
+			continue
+		}
+		if _, exists := s.inputTree.GetChild(item.Path); exists {
+			s.log(fmt.Sprintf("Journal: %s is back in input, keeping it", item.Path))
+			continue
+		}
+		kept = append(kept, item)
+	}
+	return kept
+}
+
+// beginJournal writes plan ahead of execution unless resumed
+func (s *OneWay) beginJournal(plan Plan) {
+	if s.opt.JournalPath == "" || s.journal != nil {
+		return
+	}
+	j, err := createJournal(s.opt.JournalPath, s.input.ToAbsPath("/"), s.output.ToAbsPath("/"), s.outputPathCount(), plan)
+	if err != nil {
+		s.log(fmt.Sprintf("Journal: creation error '%v', continuing without journal", err))
+		return
+	}
+	s.journal = j
+}
+
+// endJournal removes journal of successful run
+func (s *OneWay) endJournal(report SyncReport) {
+	if s.journal == nil {
+		return
+	}
+	s.journal.close()
+	s.journal = nil
+	if report.Status() != ReportOK {
+		s.log(fmt.Sprintf("Journal: kept '%s', continue with -resume", s.opt.JournalPath))
+		return
+	}
+	if err := os.Remove(s.opt.JournalPath); err != nil {
+		s.log(fmt.Sprintf("Journal: removing error '%v'", err))
+	}
+}
+
+func (s *OneWay) journalRecord(rec JournalRecord) {
+	rec.Time = time.Now()
+	if err := s.journal.write(rec); err != nil {
+		s.log(fmt.Sprintf("Journal: writing error '%v'", err))
+	}
+}
+
+// journaled records completion of handled path
+func (s *OneWay) journaled(
+	op PlanOp,
+	handler func(ctx context.Context, path string, logFn func(msg string)) error,
+) func(ctx context.Context, path string, logFn func(msg string)) error {
+	return func(ctx context.Context, path string, logFn func(msg string)) error {
+		err := handler(ctx, path, logFn)
+		if err == nil {
+			s.journalRecord(JournalRecord{Type: JournalDone, Op: op, Path: path})
+		}
+		return err
+	}
+}
+
+// reuseUploaded checks indirect file left by interrupted run. Input is
+// always rehashed, it may have changed since then keeping its size
+func (s *OneWay) reuseUploaded(path, uploadPath string, res client.Resource, logFn func(string)) bool {
+	rec, exists := s.journal.lastUpload(path)
+	if !exists || rec.UploadPath != uploadPath {
+		return false
+	}
+	uploaded, exists, err := s.output.ReadResource(uploadPath)
+	if err != nil || !exists {
+		return false
+	}
+	logFn("Hashing input to check previous upload..")
+	hashed, err := s.hashInput(path, res)
+	if err != nil {
+		return false
+	}
+	if rec.Type == JournalVerified {
+		verified := client.Resource{Size: rec.Size, HashMd5: rec.HashMd5, HashSha256: rec.HashSha256}
+		if verified.Size != hashed.Size || !isSameContentHash(hashed, verified) {
+			logFn("Input changed since previous upload")
+			return false
+		}
+	}
+	return s.checkUploadedRes(uploadPath, hashed, uploaded, hashedContent(hashed), logFn) == nil
+}
@@ -0,0 +1,115 @@
+package synchronizer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plan := Plan{
+		MakeDirs: []PlanItem{{Op: PlanMakeDir, Path: "/a/"}},
+		Uploads: []PlanItem{
+			{Op: PlanUpload, Path: "/a/1", Size: 10},
+			{Op: PlanUpload, Path: "/a/2", Size: 20},
+		},
+		Deletes: []PlanItem{{Op: PlanDelete, Path: "/old", Size: 5}},
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		output  string
+		tail    string
+		left    []string
+		wantErr bool
+	}{
+		{
+			name:   "nothing done",
+			input:  "/in/",
+			output: "/out/",
+			left:   []string{"/a/", "/a/1", "/a/2", "/old"},
+		},
+		{
+			name:   "done records",
+			input:  "/in/",
+			output: "/out/",
+			tail:   `{"Type":"Done","Op":"MakeDir","Path":"/a/"}` + "\n" + `{"Type":"Done","Op":"Upload","Path":"/a/1"}` + "\n",
+			left:   []string{"/a/2", "/old"},
+		},
+		{
+			name:   "truncated last line",
+			input:  "/in/",
+			output: "/out/",
+			tail:   `{"Type":"Done","Op":"Upload","Path":"/a/1"}` + "\n" + `{"Type":"Done","Op":"Upl`,
+			left:   []string{"/a/", "/a/2", "/old"},
+		},
+		{
+			name:    "other dirs",
+			input:   "/other/",
+			output:  "/out/",
+			wantErr: true,
+		},
+	}
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, string(rune('a'+i))+".journal")
+			j, err := createJournal(path, "/in/", "/out/", 10, plan)
+			if err != nil {
+				t.Fatal(err)
+			}
+			j.close()
+			if test.tail != "" {
+				file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				file.WriteString(test.tail)
+				file.Close()
+			}
+
+			j, left, err := openJournal(path, test.input, test.output)
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer j.close()
+			paths := planItemPaths(left.Items())
+			if len(paths) != len(test.left) {
+				t.Fatalf("left %v, expected %v", paths, test.left)
+			}
+			for k := range paths {
+				if paths[k] != test.left[k] {
+					t.Fatalf("left %v, expected %v", paths, test.left)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenJournalWithoutBeginning(t *testing.T) {
+	file, err := ioutil.TempFile("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`{"Type":"Plan","Op":"Upload","Path":"/a"}` + "\n")
+	file.Close()
+
+	_, _, err = openJournal(file.Name(), "/in/", "/out/")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
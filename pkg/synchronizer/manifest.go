@@ -0,0 +1,215 @@
+package synchronizer
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+)
+
+// OutputManifest is the last known output tree
+type OutputManifest struct {
+	SavedAt time.Time
+	Output  string
+	Entries map[string]StateResource
+}
+
+// readOutputTree loads output tree from manifest if it is trusted,
+// falls back to full read otherwise
+func (s *OneWay) readOutputTree() error {
+	if s.opt.ManifestPath == "" {
+		return s.outputTree.Read()
+	}
+	manifest := OutputManifest{}
+	exists, err := readJSONFile(s.opt.ManifestPath, &manifest)
+	if err != nil {
+		s.log(fmt.Sprintf("Manifest: '%s' reading error '%v', reading output tree..", s.opt.ManifestPath, err))
+		return s.outputTree.Read()
+	}
+	if !exists {
+		s.log(fmt.Sprintf("Manifest: '%s' not found, reading output tree..", s.opt.ManifestPath))
+		return s.outputTree.Read()
+	}
+	outputBase := s.output.ToAbsPath("/")
+	if manifest.Output != outputBase {
+		s.log(fmt.Sprintf("Manifest: belongs to '%s', expected '%s', reading output tree..", manifest.Output, outputBase))
+		return s.outputTree.Read()
+	}
+	if s.opt.RefreshOutput {
+		s.log("Manifest: refresh requested, reading output tree..")
+		return s.readOutputTreeKeepingHashes(manifest)
+	}
+	drift, err := s.verifyManifest(manifest)
+	if err != nil {
+		return err
+	}
+	if drift != "" {
+		s.log(fmt.Sprintf("Manifest: drift detected, %s. Reading output tree..", drift))
+		return s.readOutputTreeKeepingHashes(manifest)
+	}
+
+	children := map[string]client.Resource{}
+	for path, entry := range manifest.Entries {
+		children[path] = entry.ToResource(path)
+	}
+	s.outputTree.Load(children)
+	s.log(fmt.Sprintf("Manifest: loaded %d entries, saved at %s", len(children), manifest.SavedAt))
+	return nil
+}
+
+// readOutputTreeKeepingHashes reads output tree. Output files without
+// checksums keep hashes of manifest while they are of the same version
+func (s *OneWay) readOutputTreeKeepingHashes(manifest OutputManifest) error {
+	err := s.outputTree.Read()
+	if err != nil {
+		return err
+	}
+	kept := 0
+	for path, res := range s.outputTree.GetChildren() {
+		entry, exists := manifest.Entries[path]
+		if !exists || res.IsDir || res.HashMd5 != "" || res.HashSha256 != "" || !entry.isSameVersion(res) {
+			continue
+		}
+		res.HashMd5 = entry.HashMd5
+		res.HashSha256 = entry.HashSha256
+		s.outputTree.SetChild(path, res)
+		kept++
+	}
+	s.log(fmt.Sprintf("Manifest: kept hashes of %d output files", kept))
+	return nil
+}
+
+// verifyManifest compares random sample of entries with actual output
+func (s *OneWay) verifyManifest(manifest OutputManifest) (drift string, err error) {
+	paths := []string{}
+	for path := range manifest.Entries {
+		if path != "/" {
+			paths = append(paths, path)
+		}
+	}
+	sample := s.opt.ManifestSample
+	if sample > len(paths) {
+		sample = len(paths)
+	}
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	rnd.Shuffle(len(paths), func(i, j int) {
+		paths[i], paths[j] = paths[j], paths[i]
+	})
+	s.log(fmt.Sprintf("Manifest: verifying %d of %d entries..", sample, len(paths)))
+	for _, path := range paths[:sample] {
+		stored := manifest.Entries[path]
+		res, exists, err := s.output.ReadResource(path)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return fmt.Sprintf("%s not found", path), nil
+		}
+		if res.IsDir != stored.IsDir {
+			return fmt.Sprintf("%s type changed", path), nil
+		}
+		if res.IsDir {
+			continue
+		}
+		if res.Size != stored.Size {
+			return fmt.Sprintf("%s size changed (%d -> %d)", path, stored.Size, res.Size), nil
+		}
+		if matched, comparable := compareStoredHashes(res, stored); comparable && !matched {
+			return fmt.Sprintf("%s hash changed", path), nil
+		}
+	}
+	return "", nil
+}
+
+// saveManifest stores output tree updated with executed plan.
+// Failed paths are dropped to be compared again on next run
+func (s *OneWay) saveManifest(plan Plan, results map[PlanOp]*handleResult) {
+	if s.opt.ManifestPath == "" {
+		return
+	}
+	entries := map[string]StateResource{}
+	for path, res := range s.outputTree.GetChildren() {
+		entries[path] = NewStateResource(res)
+	}
+	for path, res := range s.outputTree.GetExcluded() {
+		if s.isBackupPath(path) {
+			// backup sets change by retention, not by sync
+			continue
+		}
+		entries[path] = NewStateResource(res)
+	}
+
+	for _, path := range resultDone(results[PlanMakeDir]) {
+		entries[path] = StateResource{IsDir: true, ModTime: time.Now()}
+	}
+	moveSources := map[string]string{}
+	for _, item := range plan.Moves {
+		moveSources[item.Path] = item.Src
+	}
+	for _, path := range resultDone(results[PlanMove]) {
+		delete(entries, moveSources[path])
+		s.setManifestEntry(entries, path)
+	}
+	for _, op := range []PlanOp{PlanCopy, PlanUpload} {
+		for _, path := range resultDone(results[op]) {
+			s.setManifestEntry(entries, path)
+		}
+	}
+	for _, op := range []PlanOp{PlanMove, PlanCopy, PlanUpload} {
+		if results[op] != nil {
+			for path := range results[op].Failed {
+				delete(entries, path)
+			}
+		}
+	}
+	for _, op := range []PlanOp{PlanDelete, PlanDeleteDir} {
+		for _, path := range resultDone(results[op]) {
+			delete(entries, path)
+		}
+	}
+
+	manifest := OutputManifest{
+		SavedAt: time.Now(),
+		Output:  s.output.ToAbsPath("/"),
+		Entries: entries,
+	}
+	err := writeJSONFile(s.opt.ManifestPath, manifest)
+	if err != nil {
+		s.log(fmt.Sprintf("Manifest: saving error '%v'", err))
+		return
+	}
+	s.log(fmt.Sprintf("Manifest: saved %d entries", len(entries)))
+}
+
+// setManifestEntry re-reads written file, input resource is used on error
+func (s *OneWay) setManifestEntry(entries map[string]StateResource, path string) {
+	res, exists, err := s.output.ReadResource(path)
+	if err == nil && exists {
+		if uploaded, known := s.uploadedHashes(path); known && res.HashMd5 == "" && res.HashSha256 == "" && res.Size == uploaded.Size {
+			// output exposes no checksum, hashes of sent content are kept
+			res.HashMd5 = uploaded.HashMd5
+			res.HashSha256 = uploaded.HashSha256
+		}
+		entries[path] = NewStateResource(res)
+		return
+	}
+	input, exists := s.inputTree.GetChild(path)
+	if !exists {
+		delete(entries, path)
+		return
+	}
+	entries[path] = StateResource{
+		Size:       input.Size,
+		ModTime:    input.ModTime,
+		HashMd5:    input.HashMd5,
+		HashSha256: input.HashSha256,
+	}
+}
+
+func resultDone(result *handleResult) []string {
+	if result == nil {
+		return []string{}
+	}
+	return result.Done
+}
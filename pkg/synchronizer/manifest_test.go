@@ -0,0 +1,82 @@
+package synchronizer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManifestSaved(t *testing.T) {
+	in, out, manifestDir := newTestDir(t), newTestDir(t), newTestDir(t)
+	defer os.RemoveAll(in)
+	defer os.RemoveAll(out)
+	defer os.RemoveAll(manifestDir)
+	writeTestFiles(t, in, map[string]string{"/a": "a", "/sub/b": "bb"}, time.Time{})
+	writeTestFiles(t, out, map[string]string{"/old": "old"}, time.Time{})
+
+	opt := OneWayOpt{ManifestPath: filepath.Join(manifestDir, "manifest.json"), AllowDelete: true}
+	runTestOneWay(t, newTestClient(in), newTestClient(out), opt)
+
+	manifest := OutputManifest{}
+	exists, err := readJSONFile(opt.ManifestPath, &manifest)
+	if err != nil || !exists {
+		t.Fatalf("manifest not saved, exists %t, err %v", exists, err)
+	}
+	if manifest.Output != newTestClient(out).ToAbsPath("/") {
+		t.Fatalf("manifest of %s", manifest.Output)
+	}
+	expected := map[string]int64{"/a": 1, "/sub/": 0, "/sub/b": 2}
+	for path, size := range expected {
+		entry, exists := manifest.Entries[path]
+		if !exists || entry.Size != size {
+			t.Errorf("%s: entry %+v (exists %t), expected size %d", path, entry, exists, size)
+		}
+	}
+	if _, exists := manifest.Entries["/old"]; exists {
+		t.Error("deleted /old is in manifest")
+	}
+}
+
+func TestManifestTrusted(t *testing.T) {
+	tests := []struct {
+		name    string
+		changed map[string]string
+		sample  int
+		deletes []string
+	}{
+		{name: "unchanged output", sample: 10, deletes: []string{}},
+		{name: "drift outside of sample", changed: map[string]string{"/a": "changed"}, deletes: []string{}},
+		{name: "drift", changed: map[string]string{"/a": "changed"}, sample: 10, deletes: []string{"/untracked"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in, out, manifestDir := newTestDir(t), newTestDir(t), newTestDir(t)
+			defer os.RemoveAll(in)
+			defer os.RemoveAll(out)
+			defer os.RemoveAll(manifestDir)
+			writeTestFiles(t, in, map[string]string{"/a": "a", "/b": "b"}, time.Time{})
+
+			opt := OneWayOpt{
+				ManifestPath:   filepath.Join(manifestDir, "manifest.json"),
+				ManifestSample: test.sample,
+				AllowDelete:    true,
+			}
+			runTestOneWay(t, newTestClient(in), newTestClient(out), opt)
+
+			// output tree is read only on drift, untracked file shows up then
+			writeTestFiles(t, out, map[string]string{"/untracked": "x"}, time.Time{})
+			writeTestFiles(t, out, test.changed, time.Time{})
+			plan := planTestOneWay(t, newTestClient(in), newTestClient(out), opt)
+			deletes := planItemPaths(plan.Deletes)
+			if len(deletes) != len(test.deletes) {
+				t.Fatalf("deletes %v, expected %v", deletes, test.deletes)
+			}
+			for i := range deletes {
+				if deletes[i] != test.deletes[i] {
+					t.Fatalf("deletes %v, expected %v", deletes, test.deletes)
+				}
+			}
+		})
+	}
+}
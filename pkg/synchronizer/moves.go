@@ -0,0 +1,142 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+	"github.com/io-developer/go-davsync/pkg/util"
+)
+
+// calcMoves matches new input files against output files to delete
+// by size and content hash. Only one-to-one matches are moved,
+// anything ambiguous is left to upload + delete
+func (s *OneWay) calcMoves() {
+	s.moves = map[string]string{}
+	if !s.opt.DetectMoves {
+		return
+	}
+	if !s.opt.AllowDelete {
+		s.log("Move detection skipped: deleting is not allowed")
+		return
+	}
+	s.log("Detecting moves...")
+
+	delBySize := map[int64][]string{}
+	for _, path := range s.delPaths {
+		res, _ := s.outputTree.GetChild(path)
+		if !res.IsDir {
+			delBySize[res.Size] = append(delBySize[res.Size], path)
+		}
+	}
+
+	outputHashed := map[string]client.Resource{}
+	addMatches := map[string][]string{}
+	delMatches := map[string][]string{}
+	for _, addPath := range util.PathSorted(s.addPaths) {
+		input, _ := s.inputTree.GetChild(addPath)
+		candidates := delBySize[input.Size]
+		if input.IsDir || len(candidates) == 0 {
+			continue
+		}
+		input, err := s.hashInput(addPath, input)
+		if err != nil {
+			s.log(fmt.Sprintf("MOVE? %s hashing error: %v", addPath, err))
+			continue
+		}
+		for _, delPath := range candidates {
+			output, hashed := outputHashed[delPath]
+			if !hashed {
+				output, _ = s.outputTree.GetChild(delPath)
+				if output.IsLocal() {
+					output, err = hashResource(s.output, delPath, output, nil)
+					if err != nil {
+						s.log(fmt.Sprintf("MOVE? %s hashing error: %v", delPath, err))
+					}
+				}
+				outputHashed[delPath] = output
+			}
+			if isSameContentHash(input, output) {
+				addMatches[addPath] = append(addMatches[addPath], delPath)
+				delMatches[delPath] = append(delMatches[delPath], addPath)
+			}
+		}
+	}
+
+	for _, addPath := range util.PathSorted(s.addPaths) {
+		delPaths := addMatches[addPath]
+		if len(delPaths) == 0 {
+			continue
+		}
+		if len(delPaths) > 1 || len(delMatches[delPaths[0]]) > 1 {
+			s.log(fmt.Sprintf("MOVE? %s ambiguous, %d candidates. Uploading..", addPath, len(delPaths)))
+			continue
+		}
+		s.moves[addPath] = delPaths[0]
+		s.log(fmt.Sprintf("MOVE %s -> %s", delPaths[0], addPath))
+	}
+}
+
+// isSameContentHash matches strictly by SHA256 or MD5
+func isSameContentHash(input, output client.Resource) bool {
+	if input.HashSha256 != "" && output.HashSha256 != "" {
+		return input.HashSha256 == output.HashSha256
+	}
+	if input.HashMd5 != "" && output.HashMd5 != "" {
+		return input.HashMd5 == output.HashMd5
+	}
+	return false
+}
+
+func (s *OneWay) moveOutputFile(ctx context.Context, path string, logFn func(string)) error {
+	srcPath, exists := s.moveSources[path]
+	if !exists {
+		return fmt.Errorf("Move source not found for '%s'", path)
+	}
+	src, exists := s.outputTree.GetChild(srcPath)
+	if !exists {
+		logFn("Source not exists. Uploading..")
+		return s.uploadFile(ctx, path, logFn)
+	}
+	logFn(fmt.Sprintf("Moving from %s", srcPath))
+	err := s.output.MoveFile(srcPath, path)
+	if err != nil {
+		logFn(fmt.Sprintf("Move failed '%v'. Uploading..", err))
+		return s.uploadMoved(ctx, path, srcPath, logFn)
+	}
+	moved, exists, err := s.output.ReadResource(path)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("Moved file not found '%s'", path)
+	}
+	if moved.Size != src.Size {
+		return fmt.Errorf("Moved size not matched (%d -> %d), %s", src.Size, moved.Size, path)
+	}
+	s.emit(MoveEvent{EventBase: newEventBase(), Src: srcPath, Path: path, Size: moved.Size})
+	return nil
+}
+
+// uploadMoved uploads file of failed move. Its source is no longer planned
+// for deletion, so it is deleted here unless it is gone already
+func (s *OneWay) uploadMoved(ctx context.Context, path, srcPath string, logFn func(string)) error {
+	err := s.uploadFile(ctx, path, logFn)
+	if err != nil {
+		return err
+	}
+	_, exists, err := s.output.ReadResource(srcPath)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+	if err := s.checkMoveDelete(); err != nil {
+		logFn(fmt.Sprintf("Keeping move source %s: %v", srcPath, err))
+		s.reportError("DeleteGuard", srcPath, err)
+		return nil
+	}
+	logFn(fmt.Sprintf("Deleting move source %s", srcPath))
+	return s.deleteOutputFile(ctx, srcPath, logFn)
+}
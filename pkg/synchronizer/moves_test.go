@@ -0,0 +1,139 @@
+package synchronizer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+	"github.com/io-developer/go-davsync/pkg/client/local"
+)
+
+func planTestOneWay(t *testing.T, input, output client.Client, opt OneWayOpt) Plan {
+	t.Helper()
+	s := NewOneWay(input, output, opt)
+	errs := make(chan error)
+	go func() {
+		for range errs {
+		}
+	}()
+	plan := s.Plan(context.Background(), errs)
+	close(errs)
+	return plan
+}
+
+func planItemSources(items []PlanItem) map[string]string {
+	sources := map[string]string{}
+	for _, item := range items {
+		sources[item.Path] = item.Src
+	}
+	return sources
+}
+
+func expectPlanSources(t *testing.T, op string, items []PlanItem, expected map[string]string) {
+	t.Helper()
+	sources := planItemSources(items)
+	if len(sources) != len(expected) {
+		t.Fatalf("%s %v, expected %v", op, sources, expected)
+	}
+	for path, src := range expected {
+		if sources[path] != src {
+			t.Fatalf("%s %v, expected %v", op, sources, expected)
+		}
+	}
+}
+
+func TestCalcMoves(t *testing.T) {
+	tests := []struct {
+		name     string
+		noDelete bool
+		input    map[string]string
+		output   map[string]string
+		moves    map[string]string
+	}{
+		{
+			name:   "renamed",
+			input:  map[string]string{"/new": "content", "/same": "same"},
+			output: map[string]string{"/old": "content", "/same": "same"},
+			moves:  map[string]string{"/new": "/old"},
+		},
+		{
+			name:   "moved to subdir",
+			input:  map[string]string{"/sub/a": "content"},
+			output: map[string]string{"/a": "content"},
+			moves:  map[string]string{"/sub/a": "/a"},
+		},
+		{
+			name:   "same size, other content",
+			input:  map[string]string{"/new": "content"},
+			output: map[string]string{"/old": "CONTENT"},
+			moves:  map[string]string{},
+		},
+		{
+			name:   "several sources of the same content",
+			input:  map[string]string{"/new": "content"},
+			output: map[string]string{"/old1": "content", "/old2": "content"},
+			moves:  map[string]string{},
+		},
+		{
+			name:   "several targets of the same content",
+			input:  map[string]string{"/new1": "content", "/new2": "content"},
+			output: map[string]string{"/old": "content"},
+			moves:  map[string]string{},
+		},
+		{
+			name:     "deleting is not allowed",
+			noDelete: true,
+			input:    map[string]string{"/new": "content"},
+			output:   map[string]string{"/old": "content"},
+			moves:    map[string]string{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in, out := newTestDir(t), newTestDir(t)
+			defer os.RemoveAll(in)
+			defer os.RemoveAll(out)
+			writeTestFiles(t, in, test.input, time.Time{})
+			writeTestFiles(t, out, test.output, time.Time{})
+
+			plan := planTestOneWay(t, newTestClient(in), newTestClient(out), OneWayOpt{DetectMoves: true, AllowDelete: !test.noDelete})
+			expectPlanSources(t, "moves", plan.Moves, test.moves)
+			for _, item := range plan.Deletes {
+				if _, moved := test.moves[item.Path]; moved {
+					t.Fatalf("moved %s is deleted", item.Path)
+				}
+				for _, src := range test.moves {
+					if item.Path == src {
+						t.Fatalf("move source %s is deleted", src)
+					}
+				}
+			}
+		})
+	}
+}
+
+// failingMoveClient fails every move on output
+type failingMoveClient struct {
+	*local.Client
+}
+
+func (c failingMoveClient) MoveFile(srcPath, dstPath string) error {
+	return errors.New("Move is not allowed")
+}
+
+func TestOneWayMoveFallback(t *testing.T) {
+	in, out := newTestDir(t), newTestDir(t)
+	defer os.RemoveAll(in)
+	defer os.RemoveAll(out)
+	writeTestFiles(t, in, map[string]string{"/new": "content"}, time.Time{})
+	writeTestFiles(t, out, map[string]string{"/old": "content"}, time.Time{})
+
+	report := runTestOneWay(t, newTestClient(in), failingMoveClient{newTestClient(out)}, OneWayOpt{DetectMoves: true, AllowDelete: true})
+	if report.FilesMoved != 1 {
+		t.Fatalf("moved %d, expected 1", report.FilesMoved)
+	}
+	expectTestFiles(t, out, map[string]string{"/new": "content"})
+}
@@ -1,52 +1,138 @@
 package synchronizer
 
 import (
+	"context"
 	"crypto"
 	"fmt"
+	"io"
+	"os"
 	"sync"
 	"time"
 
 	"github.com/io-developer/go-davsync/pkg/client"
+	"github.com/io-developer/go-davsync/pkg/filter"
 	"github.com/io-developer/go-davsync/pkg/log"
 	"github.com/io-developer/go-davsync/pkg/util"
 )
 
 type OneWayOpt struct {
-	IgnoreExisting         bool
-	IndirectUpload         bool
-	UploadPathFormat       string
-	AllowDelete            bool
-	SingleThreadedFileSize int64
-	ThreadCount            uint
-	AttemptMax             uint
-	AttemptDelay           time.Duration
-	UploadCheckTimeout     time.Duration
-	UploadCheckDelay       time.Duration
+	Overwrite          OverwritePolicy
+	ModifyWindow       time.Duration
+	IndirectUpload     bool
+	UploadPathFormat   string
+	AllowDelete        bool
+	Mirror             bool
+	DetectMoves        bool
+	Dedup              bool
+	ThreadCount        uint
+	AttemptMax         uint
+	AttemptDelay       time.Duration
+	UploadCheckTimeout time.Duration
+	UploadCheckDelay   time.Duration
+	Filter             *filter.Filter `json:"-"`
+	ManifestPath       string
+	ManifestSample     int
+	RefreshOutput      bool
+	JournalPath        string
+	Limiter            *util.Limiter `json:"-"`
+
+	// MaxInFlightBytes of files handled by all threads at once, zero means no limit
+	MaxInFlightBytes int64
+	QueueOrder       QueueOrder
+
+	// Events receives typed progress of sync, may be nil
+	Events EventHandler `json:"-"`
+
+	// UploadHook is called for every file put in place, its error fails the upload
+	UploadHook func(file UploadedFile) error `json:"-"`
+
+	// BackupDir on output receives deleted and overwritten files instead
+	BackupDir       string
+	BackupKeepAge   time.Duration
+	BackupKeepCount int
+
+	// MaxDelete and MaxDeletePercent of output paths, zero means no limit
+	MaxDelete        int
+	MaxDeletePercent float64
+	Force            bool
+}
+
+// UploadedFile is passed to UploadHook
+type UploadedFile struct {
+	Path          string
+	InputAbsPath  string
+	OutputAbsPath string
+	Size          int64
+	ModTime       time.Time
+	HashMd5       string
+	HashSha256    string
 }
 
 type OneWay struct {
 	opt          OneWayOpt
 	input        client.Client
 	output       client.Client
+	inputClient  client.Client
+	outputClient client.Client
 	logger       *log.Logger
 	threadLogs   chan log.ThreadLog
 	threadLogger *log.ThreadLogger
 	threadLogsWg *sync.WaitGroup
 
-	inputTree  *client.TreeBuffer
-	outputTree *client.TreeBuffer
+	threadLoggerMu sync.Mutex
+
+	inputTree       *client.TreeBuffer
+	outputTree      *client.TreeBuffer
+	outputTreeRead  bool
+	inputReadFailed bool
+
+	bothPaths      []string
+	addPaths       []string
+	delPaths       []string
+	changedPaths   []string
+	changedReasons map[string]string
+	moves          map[string]string
+	moveSources    map[string]string
+	copies         map[string]string
+	copySources    map[string]string
+
+	inFlightBytes *byteBudget
+
+	uploaded   map[string]client.Resource
+	uploadedMu sync.Mutex
 
-	bothPaths []string
-	addPaths  []string
-	delPaths  []string
+	stopCh   chan struct{}
+	stopOnce sync.Once
 
-	signleThreadUpload sync.Mutex
+	pendingUploads   map[string]bool
+	pendingUploadsMu sync.Mutex
+
+	report   SyncReport
+	reportMu sync.Mutex
+
+	journal *journal
+
+	guardDeletes int
+	guardMu      sync.Mutex
+
+	backupSet string
+	backups   map[string]bool
+	backupMu  sync.Mutex
+
+	modTimeUnsupported bool
+	modTimeMu          sync.Mutex
 }
 
 func NewOneWay(input, output client.Client, opt OneWayOpt) *OneWay {
 	if opt.UploadPathFormat == "" {
 		opt.UploadPathFormat = "/ucam-%x.bin"
 	}
+	if opt.Mirror {
+		opt.AllowDelete = true
+	}
+	if opt.Overwrite == "" {
+		opt.Overwrite = OverwriteChanged
+	}
 	if opt.ThreadCount < 1 {
 		opt.ThreadCount = 1
 	}
@@ -59,36 +145,207 @@ func NewOneWay(input, output client.Client, opt OneWayOpt) *OneWay {
 	if opt.UploadCheckDelay < time.Second {
 		opt.UploadCheckDelay = time.Second
 	}
-	return &OneWay{
-		opt:                opt,
-		input:              input,
-		output:             output,
-		logger:             log.DefaultLogger,
-		inputTree:          client.NewTreeBuffer(input),
-		outputTree:         client.NewTreeBuffer(output),
-		signleThreadUpload: sync.Mutex{},
+	if opt.QueueOrder == "" {
+		opt.QueueOrder = QueuePath
+	}
+	if opt.BackupDir != "" {
+		opt.BackupDir = util.PathNormalize(opt.BackupDir, true)
+	}
+	s := &OneWay{
+		opt:            opt,
+		input:          input,
+		output:         output,
+		inputClient:    input,
+		outputClient:   output,
+		logger:         log.DefaultLogger,
+		inputTree:      client.NewTreeBuffer(input),
+		outputTree:     client.NewTreeBuffer(output),
+		inFlightBytes:  newByteBudget(opt.MaxInFlightBytes),
+		stopCh:         make(chan struct{}),
+		pendingUploads: map[string]bool{},
+	}
+	var inputFilter, outputFilter client.Filter
+	if !opt.Filter.IsEmpty() {
+		inputFilter = opt.Filter
+	}
+	if outFilter := opt.Filter.WithoutAge(); !outFilter.IsEmpty() {
+		outputFilter = outFilter
 	}
+	if opt.BackupDir != "" {
+		inputFilter = backupFilter{opt.BackupDir, inputFilter}
+		outputFilter = backupFilter{opt.BackupDir, outputFilter}
+	}
+	if inputFilter != nil {
+		s.inputTree.SetFilter(inputFilter)
+	}
+	if outputFilter != nil {
+		s.outputTree.SetFilter(outputFilter)
+	}
+	return s
 }
 
 func (s *OneWay) SetLogger(l *log.Logger) {
 	s.logger = l
 }
 
-func (s *OneWay) Sync(errors chan<- error) {
-	s.startThreadLogs()
+// Stop lets in-flight files finish but schedules no new ones.
+// Cancel the context passed to Sync to abort immediately
+func (s *OneWay) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+}
+
+// bind makes own copies of clients bound to ctx, clients passed to NewOneWay
+// may be shared
+func (s *OneWay) bind(ctx context.Context) {
+	s.input = client.WithContext(s.inputClient, ctx)
+	s.output = client.WithContext(s.outputClient, ctx)
+	s.inputTree.SetClient(s.input)
+	s.outputTree.SetClient(s.output)
+}
+
+func (s *OneWay) isStopped(ctx context.Context) bool {
+	select {
+	case <-s.stopCh:
+		return true
+	case <-ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// Sync plans and executes the plan at once
+func (s *OneWay) Sync(ctx context.Context, errors chan<- error) SyncReport {
+	plan := s.Plan(ctx, errors)
+	return s.Execute(ctx, plan, errors)
+}
+
+// TreesRead tells whether both trees of the last plan were read without errors
+func (s *OneWay) TreesRead() bool {
+	return !s.inputReadFailed && s.outputTreeRead
+}
+
+// Plan reads both trees and calculates operations without touching output
+func (s *OneWay) Plan(ctx context.Context, errors chan<- error) Plan {
+	s.bind(ctx)
+
+	s.report = newSyncReport()
+	timeStart := time.Now()
 
 	s.readTrees(errors)
+	s.logExcluded()
 	s.calcDiff()
+	s.calcChanged()
+	s.calcMoves()
+	s.calcCopies()
+	plan := s.buildPlan()
+	s.emit(PlanEvent{EventBase: newEventBase(), Plan: plan})
+
+	s.report.PlanDuration = time.Now().Sub(timeStart)
+	return plan
+}
+
+// Execute applies the plan to output and reports the outcome
+func (s *OneWay) Execute(ctx context.Context, plan Plan, errors chan<- error) SyncReport {
+	s.bind(ctx)
+
+	if s.report.StartedAt.IsZero() {
+		s.report = newSyncReport()
+	}
+	timeStart := time.Now()
+
+	if err := s.CheckDeletes(plan); err != nil {
+		return s.refuse(ctx, plan, err, errors)
+	}
+	s.guardDeletes = len(plan.Deletes) + len(plan.DeleteDirs)
 
-	s.makeDirs(errors)
+	if s.opt.ManifestPath != "" {
+		// manifest is stale from now on until saved at the end
+		os.Remove(s.opt.ManifestPath)
+	}
+	s.uploadedMu.Lock()
+	s.uploaded = map[string]client.Resource{}
+	s.uploadedMu.Unlock()
+	s.beginJournal(plan)
+	s.startBackupSet()
+	s.startThreadLogs()
+
+	report := &s.report
+	results := map[PlanOp]*handleResult{}
+	results[PlanMakeDir] = s.makeDirs(ctx, plan.MakeDirs, errors)
+	report.DirsCreated = report.addResult(PlanMakeDir, results[PlanMakeDir])
+
+	s.moveSources = map[string]string{}
+	for _, item := range plan.Moves {
+		s.moveSources[item.Path] = item.Src
+	}
+	results[PlanMove] = s.handlePaths(ctx, PlanMove, planItemPaths(plan.Moves), nil, s.journaled(PlanMove, s.moveOutputFile), "MOV", errors)
+	report.FilesMoved = report.addResult(PlanMove, results[PlanMove])
+
+	results[PlanUpload] = s.handlePaths(ctx, PlanUpload, planItemPaths(plan.Uploads), s.inputTree, s.journaled(PlanUpload, s.uploadFile), "UPL", errors)
+	report.FilesUploaded = report.addResult(PlanUpload, results[PlanUpload])
+	uploadSizes := map[string]int64{}
+	for _, item := range plan.Uploads {
+		uploadSizes[item.Path] = item.Size
+	}
+	for _, path := range results[PlanUpload].Done {
+		report.BytesTransferred += uploadSizes[path]
+	}
 
-	s.handlePaths(s.addPaths, s.uploadFile, "UPL", errors)
+	s.copySources = map[string]string{}
+	for _, item := range plan.Copies {
+		s.copySources[item.Path] = item.Src
+	}
+	results[PlanCopy] = s.handlePaths(ctx, PlanCopy, planItemPaths(plan.Copies), nil, s.journaled(PlanCopy, s.copyOutputFile), "CPY", errors)
+	report.FilesCopied = report.addResult(PlanCopy, results[PlanCopy])
 
 	if s.opt.AllowDelete {
-		s.handlePaths(s.delPaths, s.deleteOutputFile, "DEL", errors)
+		results[PlanDelete] = s.handlePaths(ctx, PlanDelete, planItemPaths(plan.Deletes), nil, s.journaled(PlanDelete, s.deleteOutputFile), "DEL", errors)
+		report.FilesDeleted = report.addResult(PlanDelete, results[PlanDelete])
+	}
+	if s.opt.Mirror {
+		results[PlanDeleteDir] = s.deleteOutputDirs(ctx, plan.DeleteDirs, errors)
+		report.DirsDeleted = report.addResult(PlanDeleteDir, results[PlanDeleteDir])
 	}
 
 	s.finishThreadLogs()
+	report.FilesBackedUp = s.backedUpCount()
+
+	s.cleanupPendingUploads()
+	if !s.isStopped(ctx) {
+		s.pruneBackups(errors)
+	}
+	if s.outputTreeRead {
+		s.saveManifest(plan, results)
+	}
+	s.applyResults(plan, results)
+
+	report.ExecuteDuration = time.Now().Sub(timeStart)
+	report.finish(ctx, s.isStopped(ctx))
+	LogReport(*report, s.log)
+	s.endJournal(*report)
+
+	result := *report
+	s.report = SyncReport{}
+	s.emit(SyncFinishEvent{EventBase: newEventBase(), Report: result})
+	return result
+}
+
+// refuse reports plan as not started at all
+func (s *OneWay) refuse(ctx context.Context, plan Plan, err error, errors chan<- error) SyncReport {
+	errors <- err
+	s.report.addError("DeleteGuard", "", err)
+	s.report.NotStarted += len(plan.Items())
+	s.report.finish(ctx, false)
+	s.report.State = ReportAborted
+	LogReport(s.report, s.log)
+
+	result := s.report
+	s.report = SyncReport{}
+	s.emit(SyncFinishEvent{EventBase: newEventBase(), Report: result})
+	return result
 }
 
 func (s *OneWay) logFmt(msg string) string {
@@ -99,9 +356,22 @@ func (s *OneWay) log(msg string) {
 	log.Info(s.logFmt(msg))
 }
 
+// InFlight returns the current work of each busy thread
+func (s *OneWay) InFlight() []log.ThreadLog {
+	s.threadLoggerMu.Lock()
+	threadLogger := s.threadLogger
+	s.threadLoggerMu.Unlock()
+	if threadLogger == nil {
+		return []log.ThreadLog{}
+	}
+	return threadLogger.Snapshot()
+}
+
 func (s *OneWay) startThreadLogs() {
 	s.threadLogs = make(chan log.ThreadLog)
+	s.threadLoggerMu.Lock()
 	s.threadLogger = log.NewThreadLogger(s.threadLogs, s.opt.ThreadCount)
+	s.threadLoggerMu.Unlock()
 	s.threadLogsWg = &sync.WaitGroup{}
 	go func() {
 		s.log("Listening thread logs..")
@@ -123,32 +393,62 @@ func (s *OneWay) readTrees(errors chan<- error) {
 	group := sync.WaitGroup{}
 	group.Add(2)
 	go func() {
-		if err := s.inputTree.Read(); err != nil {
+		s.emit(TreeReadStartEvent{EventBase: newEventBase(), Side: TreeInput})
+		err := s.inputTree.Read()
+		if err != nil {
+			s.reportError("ReadInput", "", err)
 			errors <- err
 		}
+		s.inputReadFailed = err != nil
+		s.emitTreeRead(TreeInput, s.inputTree, err)
 		group.Done()
 	}()
 	go func() {
-		if err := s.outputTree.Read(); err != nil {
+		s.emit(TreeReadStartEvent{EventBase: newEventBase(), Side: TreeOutput})
+		err := s.readOutputTree()
+		if err != nil {
+			s.reportError("ReadOutput", "", err)
 			errors <- err
 		}
+		s.outputTreeRead = err == nil
+		s.emitTreeRead(TreeOutput, s.outputTree, err)
 		group.Done()
 	}()
 	group.Wait()
 }
 
+func (s *OneWay) logExcluded() {
+	if counter, ok := s.input.(client.IgnoreCounter); ok {
+		s.log(fmt.Sprintf("Ignore files excluded %d input paths", counter.IgnoredCount()))
+	}
+	if counter, ok := s.output.(client.IgnoreCounter); ok {
+		s.log(fmt.Sprintf("Ignore files excluded %d output paths", counter.IgnoredCount()))
+	}
+	if s.opt.Filter.IsEmpty() {
+		return
+	}
+	inputExcluded := s.inputTree.GetExcludedPaths()
+	outputExcluded := s.outputTree.GetExcludedPaths()
+	s.log(fmt.Sprintf("Filter excluded %d input and %d output paths", len(inputExcluded), len(outputExcluded)))
+	for _, path := range inputExcluded {
+		log.Debug(s.logFmt(fmt.Sprintf("EXCLUDED input %s", path)))
+	}
+	for _, path := range outputExcluded {
+		log.Debug(s.logFmt(fmt.Sprintf("EXCLUDED output %s", path)))
+	}
+}
+
 func (s *OneWay) calcDiff() {
+	s.diffPaths(s.inputTree.GetChildrenPaths(), s.outputTree.GetChildrenPaths())
+}
+
+func (s *OneWay) diffPaths(inputPaths, outputPaths []string) {
 	s.log("Calculating input/output path diff...")
 
-	s.bothPaths, s.addPaths, s.delPaths = util.Diff(
-		s.inputTree.GetChildrenPaths(),
-		s.outputTree.GetChildrenPaths(),
-	)
+	s.bothPaths, s.addPaths, s.delPaths = util.Diff(inputPaths, outputPaths)
+	s.delPaths = s.keepInputExcluded(s.delPaths)
 
 	s.log("Path diff:")
-	for _, path := range s.bothPaths {
-		s.log(fmt.Sprintf("BOTH %s", path))
-	}
 	for _, path := range s.addPaths {
 		s.log(fmt.Sprintf("ADD %s", path))
 	}
@@ -157,30 +457,112 @@ func (s *OneWay) calcDiff() {
 	}
 }
 
-func (s *OneWay) makeDirs(errors chan<- error) {
-	s.log("Making dirs...")
+// keepInputExcluded leaves output paths excluded from input by filter or
+// ignore files out of deletion, they are excluded on output as well
+func (s *OneWay) keepInputExcluded(delPaths []string) []string {
+	ignorer, _ := s.input.(client.Ignorer)
+	kept := []string{}
+	for _, path := range delPaths {
+		res, _ := s.outputTree.GetChild(path)
+		if s.inputTree.IsExcluded(path) || (ignorer != nil && ignorer.IsIgnored(path, res.IsDir)) {
+			log.Debug(s.logFmt(fmt.Sprintf("EXCLUDED output %s, excluded on input", path)))
+			s.outputTree.Exclude(path)
+			continue
+		}
+		kept = append(kept, path)
+	}
+	return kept
+}
 
-	bothPathDirs := util.PathSortedDirs(s.bothPaths)
-	addPathDirs := util.PathSortedDirs(s.addPaths)
-	_, addDirs, _ := util.Diff(addPathDirs, bothPathDirs)
-	addDirs = util.PathSortedDirs(addDirs)
+func (s *OneWay) calcChanged() {
+	s.log(fmt.Sprintf("Comparing existing input/output files, overwrite policy '%s'...", s.opt.Overwrite))
 
-	for _, path := range addDirs {
+	s.changedPaths = []string{}
+	s.changedReasons = map[string]string{}
+	for _, path := range s.bothPaths {
+		input, _ := s.inputTree.GetChild(path)
+		output, _ := s.outputTree.GetChild(path)
+		if input.IsDir && output.IsDir {
+			continue
+		}
+		if input.IsDir != output.IsDir {
+			s.log(fmt.Sprintf("BOTH %s skip: type mismatch, input dir %t, output dir %t", path, input.IsDir, output.IsDir))
+			s.report.FilesSkipped++
+			continue
+		}
+		overwrite, reason := s.compareResources(path, input, output)
+		if overwrite {
+			s.changedPaths = append(s.changedPaths, path)
+			s.changedReasons[path] = reason
+			s.log(fmt.Sprintf("BOTH %s [%s] overwrite: %s", path, s.opt.Overwrite, reason))
+		} else {
+			s.log(fmt.Sprintf("BOTH %s [%s] keep: %s", path, s.opt.Overwrite, reason))
+			s.report.FilesSkipped++
+		}
+	}
+}
+
+func (s *OneWay) makeDirs(ctx context.Context, items []PlanItem, errors chan<- error) *handleResult {
+	s.log("Making dirs...")
+
+	result := newHandleResult()
+	for i, path := range planItemPaths(items) {
+		if s.isStopped(ctx) {
+			result.skip(planItemPaths(items[i:])...)
+			break
+		}
 		s.log(fmt.Sprintf("  make dir %s", path))
 
 		err := s.outputTree.MakeDir(path, true)
 		if err != nil {
 			errors <- err
+			result.fail(path, err)
+		} else {
+			result.done(path)
+			s.journalRecord(JournalRecord{Type: JournalDone, Op: PlanMakeDir, Path: path})
+		}
+	}
+	return result
+}
+
+// deleteOutputDirs expects items sorted deepest first
+func (s *OneWay) deleteOutputDirs(ctx context.Context, items []PlanItem, errors chan<- error) *handleResult {
+	s.log("Deleting dirs...")
+
+	result := newHandleResult()
+	for i, path := range planItemPaths(items) {
+		if s.isStopped(ctx) {
+			result.skip(planItemPaths(items[i:])...)
+			break
+		}
+		s.log(fmt.Sprintf("  delete dir %s", path))
+
+		err := s.output.DeleteDir(path)
+		if err != nil {
+			errors <- err
+			result.fail(path, err)
+		} else {
+			result.done(path)
+			s.journalRecord(JournalRecord{Type: JournalDone, Op: PlanDeleteDir, Path: path})
+			s.emit(DeleteEvent{EventBase: newEventBase(), Path: path, IsDir: true})
 		}
 	}
+	return result
 }
 
+// handlePaths runs handler in threads. Files of tree are queued in QueueOrder
+// and weighed by size against MaxInFlightBytes, nil tree keeps path order
 func (s *OneWay) handlePaths(
+	ctx context.Context,
+	op PlanOp,
 	paths []string,
-	handler func(path string, logFn func(msg string)) error,
+	tree *client.TreeBuffer,
+	handler func(ctx context.Context, path string, logFn func(msg string)) error,
 	logPrefix string,
 	errors chan<- error,
-) {
+) *handleResult {
+	result := newHandleResult()
+
 	total := 0
 	handled := 0
 	logFmt := func(msg string) string {
@@ -204,14 +586,23 @@ func (s *OneWay) handlePaths(
 	logMain("Handling...")
 	if len(paths) == 0 {
 		logMain("Nothing to do")
-		return
+		return result
 	}
 
-	sortedPaths := util.PathSorted(paths)
-	total = len(sortedPaths)
+	queue := newPathQueue(s.inFlightBytes, orderPaths(paths, tree, s.opt.QueueOrder), tree)
+	total = len(paths)
 
-	pathsCh := make(chan string)
 	group := sync.WaitGroup{}
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-s.stopCh:
+		case <-ctx.Done():
+		case <-finished:
+			return
+		}
+		result.skip(queue.close()...)
+	}()
 
 	thread := func(id uint) {
 		curPath := "-"
@@ -226,6 +617,7 @@ func (s *OneWay) handlePaths(
 				TaskId: taskCounter,
 				Level:  log.InfoLevel,
 				Msg:    s.logFmt(logFmt(logThreadFmt(msg))),
+				Path:   curPath,
 			}
 		}
 		logThreadComplete := func() {
@@ -236,36 +628,58 @@ func (s *OneWay) handlePaths(
 			}
 		}
 		for {
-			select {
-			case path, ok := <-pathsCh:
-				if !ok {
-					logThreadComplete()
-					group.Done()
-					return
+			if s.isStopped(ctx) {
+				result.skip(queue.close()...)
+			}
+			path, ok := queue.next()
+			if !ok {
+				logThreadComplete()
+				group.Done()
+				return
+			}
+			curPath = path
+			taskCounter++
+			var size int64
+			if tree != nil {
+				res, _ := tree.GetChild(path)
+				size = res.Size
+			}
+			var handleErr error = nil
+			attempts := uint(0)
+			for i := uint(1); i <= s.opt.AttemptMax; i++ {
+				if i > 1 || i == s.opt.AttemptMax {
+					logThread(fmt.Sprintf("Attempt %d/%d", i, s.opt.AttemptMax))
 				}
-				curPath = path
-				taskCounter++
-				var handleErr error = nil
-				for i := uint(1); i <= s.opt.AttemptMax; i++ {
-					if i > 1 || i == s.opt.AttemptMax {
-						logThread(fmt.Sprintf("Attempt %d/%d", i, s.opt.AttemptMax))
-					}
-					handleErr = handler(path, logThread)
-					if handleErr == nil {
-						break
-					}
-					logThread(fmt.Sprintf("Attempt %d/%d ERR: '%v'", i, s.opt.AttemptMax, handleErr))
-					time.Sleep(s.opt.AttemptDelay)
+				if i > 1 && !queue.retake(path) {
+					break
 				}
-				if handleErr != nil {
-					logThread(fmt.Sprintf("ERR '%v'", handleErr))
-					errors <- handleErr
-				} else {
-					logThread("Complete")
+				attempts = i
+				s.emit(FileStartEvent{EventBase: newEventBase(), Op: op, Path: path, Size: size, Attempt: i})
+				handleErr = handler(ctx, path, logThread)
+				if handleErr == nil {
+					break
 				}
-				handled++
-				curPath = "-"
+				logThread(fmt.Sprintf("Attempt %d/%d ERR: '%v'", i, s.opt.AttemptMax, handleErr))
+				if s.isStopped(ctx) || i == s.opt.AttemptMax {
+					break
+				}
+				select {
+				case <-time.After(s.opt.AttemptDelay):
+				case <-ctx.Done():
+				}
+			}
+			s.inFlightBytes.release(path)
+			s.emit(FileFinishEvent{EventBase: newEventBase(), Op: op, Path: path, Attempts: attempts, Err: handleErr})
+			if handleErr != nil {
+				logThread(fmt.Sprintf("ERR '%v'", handleErr))
+				errors <- handleErr
+				result.fail(path, handleErr)
+			} else {
+				logThread("Complete")
+				result.done(path)
 			}
+			handled++
+			curPath = "-"
 		}
 	}
 
@@ -273,17 +687,18 @@ func (s *OneWay) handlePaths(
 		group.Add(1)
 		go thread(i)
 	}
-	for _, path := range sortedPaths {
-		pathsCh <- path
-	}
-	close(pathsCh)
-
 	group.Wait()
+	close(finished)
 
-	logMain("Complete")
+	if len(result.Skipped) > 0 {
+		logMain(fmt.Sprintf("Stopped, %d not started", len(result.Skipped)))
+	} else {
+		logMain("Complete")
+	}
+	return result
 }
 
-func (s *OneWay) uploadFile(path string, logFn func(string)) error {
+func (s *OneWay) uploadFile(ctx context.Context, path string, logFn func(string)) error {
 	res, exists := s.inputTree.GetChild(path)
 	if !exists {
 		logFn("Not exists. Skiping..")
@@ -294,33 +709,42 @@ func (s *OneWay) uploadFile(path string, logFn func(string)) error {
 		return nil
 	}
 
-	isSingleThreadLocked := true
-	s.signleThreadUpload.Lock()
-
-	if !s.isSingleThreadUploadNeeded(res) {
-		isSingleThreadLocked = false
-		s.signleThreadUpload.Unlock()
-	} else {
-		logFn("Single-thread upload begin..")
+	// bytes are in flight until input is read, the upload check does not count
+	releaseBytes := func() {
+		s.inFlightBytes.release(path)
 	}
 
-	unlockIfNeeded := func() {
-		if isSingleThreadLocked {
-			isSingleThreadLocked = false
-
-			logFn("Single-thread upload end")
-			s.signleThreadUpload.Unlock()
+	// overwritten file is backed up only once new content is verified
+	indirect := s.opt.IndirectUpload || s.backsUpOverwritten(path)
+	uploadPath := s.getUploadPath(path, res, indirect)
+	if path != uploadPath && s.reuseUploaded(path, uploadPath, res, logFn) {
+		releaseBytes()
+		if err := s.backupOverwritten(path, logFn); err != nil {
+			return err
 		}
+		logFn(fmt.Sprintf("Reusing previous upload, moving %s", uploadPath))
+		err := s.output.MoveFile(uploadPath, path)
+		if err != nil {
+			return err
+		}
+		return s.afterUpload(path, res, logFn)
 	}
-
-	uploadPath := s.getUploadPath(path, res, s.opt.IndirectUpload)
 	logFn(fmt.Sprintf("Uploading to '%s'", uploadPath))
 
 	inputReader, err := s.input.ReadFile(path)
 	if err != nil {
-		unlockIfNeeded()
 		return err
 	}
+	if path != uploadPath {
+		s.addPendingUpload(uploadPath)
+		s.journalRecord(JournalRecord{
+			Type:       JournalUpload,
+			Op:         PlanUpload,
+			Path:       path,
+			UploadPath: uploadPath,
+			Size:       res.Size,
+		})
+	}
 
 	logRead := func(r *util.Reader) {
 		logFn(fmt.Sprintf(
@@ -333,8 +757,18 @@ func (s *OneWay) uploadFile(path string, logFn func(string)) error {
 	readerLogInterval := 2 * time.Second
 	readerLogLastTime := time.Now()
 
-	reader := util.NewRead(inputReader, res.Size)
+	var pipeReader io.ReadCloser = util.NewContextReader(ctx, inputReader)
+	if s.opt.Limiter != nil {
+		pipeReader = util.NewLimitedReader(ctx, pipeReader, s.opt.Limiter)
+	}
+	reader := util.NewRead(pipeReader, res.Size)
 	reader.OnProgress = func(r *util.Reader) {
+		s.emit(ProgressEvent{
+			EventBase:  newEventBase(),
+			Path:       path,
+			BytesRead:  r.GetBytesRead(),
+			BytesTotal: r.GetBytesTotal(),
+		})
 		if time.Now().Sub(readerLogLastTime) >= readerLogInterval {
 			readerLogLastTime = time.Now()
 			logRead(r)
@@ -342,13 +776,17 @@ func (s *OneWay) uploadFile(path string, logFn func(string)) error {
 	}
 	reader.OnComplete = func(r *util.Reader) {
 		logRead(r)
-		unlockIfNeeded()
+		releaseBytes()
 	}
 
 	err = s.output.WriteFile(uploadPath, reader, res.Size)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		reader.Close()
+		return ctxErr
+	}
 	time.Sleep(time.Second)
 
-	unlockIfNeeded()
+	releaseBytes()
 	reader.Close()
 
 	logFn(fmt.Sprintf("Reader IsComplete %t", reader.IsComplete()))
@@ -363,27 +801,89 @@ func (s *OneWay) uploadFile(path string, logFn func(string)) error {
 	logFn(fmt.Sprintf("Read sha256: %s", reader.GetHashSha256()))
 
 	logFn(fmt.Sprintf("Checking %s", uploadPath))
-	err = s.checkUploaded(uploadPath, res, reader, logFn)
+	err = s.checkUploaded(ctx, uploadPath, res, reader, logFn)
+	s.emit(VerifyEvent{
+		EventBase:  newEventBase(),
+		Path:       path,
+		UploadPath: uploadPath,
+		Size:       reader.GetBytesRead(),
+		HashMd5:    reader.GetHashMd5(),
+		HashSha256: reader.GetHashSha256(),
+		Err:        err,
+	})
 	if err != nil {
 		return err
 	}
 
 	if path != uploadPath {
+		s.journalRecord(JournalRecord{
+			Type:       JournalVerified,
+			Op:         PlanUpload,
+			Path:       path,
+			UploadPath: uploadPath,
+			Size:       reader.GetBytesRead(),
+			HashMd5:    reader.GetHashMd5(),
+			HashSha256: reader.GetHashSha256(),
+		})
+		err = s.backupOverwritten(path, logFn)
+		if err != nil {
+			return err
+		}
 		logFn(fmt.Sprintf("Moving %s", uploadPath))
 		err = s.output.MoveFile(uploadPath, path)
 		if err != nil {
 			return err
 		}
+		s.removePendingUpload(uploadPath)
 	}
+	res.HashMd5 = reader.GetHashMd5()
+	res.HashSha256 = reader.GetHashSha256()
+	return s.afterUpload(path, res, logFn)
+}
 
-	return nil
+// afterUpload finishes file put in place on output
+func (s *OneWay) afterUpload(path string, res client.Resource, logFn func(string)) error {
+	s.rememberUploaded(path, res)
+	s.keepModTime(path, res, logFn)
+	if s.opt.UploadHook == nil {
+		return nil
+	}
+	logFn("Running upload hook")
+	return s.opt.UploadHook(UploadedFile{
+		Path:          path,
+		InputAbsPath:  res.AbsPath,
+		OutputAbsPath: s.output.ToAbsPath(path),
+		Size:          res.Size,
+		ModTime:       res.ModTime,
+		HashMd5:       res.HashMd5,
+		HashSha256:    res.HashSha256,
+	})
 }
 
-func (s *OneWay) isSingleThreadUploadNeeded(res client.Resource) bool {
-	if s.opt.SingleThreadedFileSize <= 0 {
-		return false
+// keepModTime sets input mtime on written output file if backend can do it.
+// It is not an upload error, unsupported backends are not asked again
+func (s *OneWay) keepModTime(path string, input client.Resource, logFn func(string)) {
+	setter, ok := s.output.(client.ModTimeSetter)
+	if !ok || input.ModTime.IsZero() {
+		return
+	}
+	s.modTimeMu.Lock()
+	unsupported := s.modTimeUnsupported
+	s.modTimeMu.Unlock()
+	if unsupported {
+		return
+	}
+	err := setter.SetModTime(path, input.ModTime)
+	if err == client.ErrNotSupported {
+		s.modTimeMu.Lock()
+		s.modTimeUnsupported = true
+		s.modTimeMu.Unlock()
+		s.log("Output keeps its own mtime of uploaded files, setting it is not supported")
+		return
+	}
+	if err != nil {
+		logFn(fmt.Sprintf("Setting mtime ERR '%v'", err))
 	}
-	return res.Size > s.opt.SingleThreadedFileSize
 }
 
 func (s *OneWay) getUploadPath(path string, res client.Resource, indirect bool) string {
@@ -397,9 +897,10 @@ func (s *OneWay) getUploadPath(path string, res client.Resource, indirect bool)
 }
 
 func (s *OneWay) checkUploaded(
+	ctx context.Context,
 	path string,
 	res client.Resource,
-	r *util.Reader,
+	r checkedContent,
 	logFn func(string),
 ) (err error) {
 	if !r.IsComplete() {
@@ -413,7 +914,7 @@ func (s *OneWay) checkUploaded(
 	}
 	timeout := s.opt.UploadCheckTimeout
 	timeStart := time.Now()
-	for time.Now().Sub(timeStart) < timeout {
+	for time.Now().Sub(timeStart) < timeout && ctx.Err() == nil {
 		logFn(fmt.Sprintf(
 			"Checking (%s / %s) '%s'",
 			time.Now().Sub(timeStart).String(),
@@ -428,18 +929,39 @@ func (s *OneWay) checkUploaded(
 				return
 			}
 		}
-		time.Sleep(s.opt.UploadCheckDelay)
+		select {
+		case <-time.After(s.opt.UploadCheckDelay):
+		case <-ctx.Done():
+		}
 	}
 	if err != nil {
 		return err
 	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
 	return fmt.Errorf("File uploaded but not found atfer timeout %s", timeout.String())
 }
 
+// checkedContent is what was sent, as seen by util.Reader,
+// or known by hashes for copied files
+type checkedContent interface {
+	uploadedContent
+	IsComplete() bool
+	GetBytesTotal() int64
+}
+
+// uploadedContent is what was sent, as seen by util.Reader
+type uploadedContent interface {
+	GetBytesRead() int64
+	GetHashMd5() string
+	GetHashSha256() string
+}
+
 func (s *OneWay) checkUploadedRes(
 	path string,
 	input, uploaded client.Resource,
-	r *util.Reader,
+	r uploadedContent,
 	logFn func(string),
 ) (err error) {
 	if uploaded.HashSha256 != "" {
@@ -489,7 +1011,7 @@ func (s *OneWay) checkUploadedRes(
 	)
 }
 
-func (s *OneWay) deleteOutputFile(path string, logFn func(string)) error {
+func (s *OneWay) deleteOutputFile(ctx context.Context, path string, logFn func(string)) error {
 	res, exists := s.outputTree.GetChild(path)
 	if !exists {
 		logFn("Not exists. Skiping..")
@@ -499,5 +1021,62 @@ func (s *OneWay) deleteOutputFile(path string, logFn func(string)) error {
 		logFn("Direcory. Skiping..")
 		return nil
 	}
-	return s.output.DeleteFile(path)
+	var err error
+	if s.opt.BackupDir != "" {
+		err = s.backupOutputFile(path, logFn)
+	} else {
+		err = s.output.DeleteFile(path)
+	}
+	if err == nil {
+		s.emit(DeleteEvent{EventBase: newEventBase(), Path: path, Size: res.Size, BackedUp: s.opt.BackupDir != ""})
+	}
+	return err
+}
+
+func (s *OneWay) reportError(op, path string, err error) {
+	s.reportMu.Lock()
+	s.report.addError(op, path, err)
+	s.reportMu.Unlock()
+}
+
+func (s *OneWay) addPendingUpload(uploadPath string) {
+	s.pendingUploadsMu.Lock()
+	s.pendingUploads[uploadPath] = true
+	s.pendingUploadsMu.Unlock()
+}
+
+func (s *OneWay) removePendingUpload(uploadPath string) {
+	s.pendingUploadsMu.Lock()
+	delete(s.pendingUploads, uploadPath)
+	s.pendingUploadsMu.Unlock()
+}
+
+// cleanupPendingUploads deletes indirect upload files never moved into place.
+// Runs on its own context since the sync one may be already cancelled
+func (s *OneWay) cleanupPendingUploads() {
+	s.pendingUploadsMu.Lock()
+	defer s.pendingUploadsMu.Unlock()
+
+	if len(s.pendingUploads) == 0 {
+		return
+	}
+	if s.journal != nil {
+		s.log(fmt.Sprintf("Keeping %d unfinished uploads for resume", len(s.pendingUploads)))
+		return
+	}
+	s.log(fmt.Sprintf("Cleaning up %d unfinished uploads...", len(s.pendingUploads)))
+
+	cleanupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	output := client.WithContext(s.outputClient, cleanupCtx)
+
+	for uploadPath := range s.pendingUploads {
+		err := output.DeleteFile(uploadPath)
+		if err != nil {
+			s.log(fmt.Sprintf("  delete %s ERR '%v'", uploadPath, err))
+			continue
+		}
+		s.log(fmt.Sprintf("  deleted %s", uploadPath))
+		delete(s.pendingUploads, uploadPath)
+	}
 }
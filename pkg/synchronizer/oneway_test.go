@@ -0,0 +1,192 @@
+package synchronizer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+	"github.com/io-developer/go-davsync/pkg/client/local"
+	"github.com/io-developer/go-davsync/pkg/filter"
+)
+
+func newTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "davsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func newTestClient(dir string) *local.Client {
+	return local.NewClient(local.Options{BaseDir: dir, DirMode: 0755, FileMode: 0644})
+}
+
+// writeTestFiles writes files by relative path, mtime of all is set to modTime unless zero
+func writeTestFiles(t *testing.T, dir string, files map[string]string, modTime time.Time) {
+	for path, content := range files {
+		absPath := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(absPath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if !modTime.IsZero() {
+			if err := os.Chtimes(absPath, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// readTestFiles returns content of all files below dir by relative path
+func readTestFiles(t *testing.T, dir string) map[string]string {
+	files := map[string]string{}
+	err := filepath.Walk(dir, func(absPath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		bytes, err := ioutil.ReadFile(absPath)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, absPath)
+		files["/"+filepath.ToSlash(rel)] = string(bytes)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func expectTestFiles(t *testing.T, dir string, expected map[string]string) {
+	t.Helper()
+	files := readTestFiles(t, dir)
+	for path, content := range expected {
+		if got, exists := files[path]; !exists || got != content {
+			t.Errorf("%s: got %q (exists %t), expected %q", path, got, exists, content)
+		}
+	}
+	for path := range files {
+		if _, exists := expected[path]; !exists {
+			t.Errorf("%s: unexpected file", path)
+		}
+	}
+}
+
+func runTestOneWay(t *testing.T, input, output client.Client, opt OneWayOpt) SyncReport {
+	t.Helper()
+	if opt.ThreadCount == 0 {
+		opt.ThreadCount = 2
+	}
+	s := NewOneWay(input, output, opt)
+	errors := make(chan error)
+	go func() {
+		for range errors {
+		}
+	}()
+	report := s.Sync(context.Background(), errors)
+	close(errors)
+	return report
+}
+
+func TestOneWayAgeLimitsApplyToInputOnly(t *testing.T) {
+	in, out := newTestDir(t), newTestDir(t)
+	defer os.RemoveAll(in)
+	defer os.RemoveAll(out)
+	old := time.Now().Add(-48 * time.Hour)
+	writeTestFiles(t, in, map[string]string{"/old": "old", "/recent": "recent"}, old)
+	writeTestFiles(t, in, map[string]string{"/new": "new"}, time.Time{})
+	// synced before, its input is too new now
+	writeTestFiles(t, out, map[string]string{"/new": "previous"}, time.Time{})
+
+	f, err := filter.New(filter.Options{MinAge: time.Hour, MaxAge: 72 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opt := OneWayOpt{Filter: f, AllowDelete: true}
+	runTestOneWay(t, newTestClient(in), newTestClient(out), opt)
+	expected := map[string]string{"/old": "old", "/recent": "recent", "/new": "previous"}
+	expectTestFiles(t, out, expected)
+
+	// uploaded files are fresh on output, still not uploaded again
+	report := runTestOneWay(t, newTestClient(in), newTestClient(out), opt)
+	if report.FilesUploaded != 0 {
+		t.Errorf("%d files uploaded again", report.FilesUploaded)
+	}
+	expectTestFiles(t, out, expected)
+}
+
+func TestOneWayKeepsOutputOfIgnoredInput(t *testing.T) {
+	in, out := newTestDir(t), newTestDir(t)
+	defer os.RemoveAll(in)
+	defer os.RemoveAll(out)
+	files := map[string]string{"/a": "a", "/cache/x": "x", "/sub/b.log": "b", "/sub/c": "c"}
+	writeTestFiles(t, in, files, time.Time{})
+	newInput := func() *local.Client {
+		return local.NewClient(local.Options{BaseDir: in, DirMode: 0755, FileMode: 0644, IgnoreFile: ".davsyncignore"})
+	}
+	opt := OneWayOpt{AllowDelete: true, Mirror: true}
+	runTestOneWay(t, newInput(), newTestClient(out), opt)
+	expectTestFiles(t, out, files)
+
+	// ignored after being synced
+	writeTestFiles(t, in, map[string]string{
+		"/.davsyncignore":     "cache/\n",
+		"/sub/.davsyncignore": "*.log\n",
+	}, time.Time{})
+	runTestOneWay(t, newInput(), newTestClient(out), opt)
+	files["/.davsyncignore"] = "cache/\n"
+	files["/sub/.davsyncignore"] = "*.log\n"
+	expectTestFiles(t, out, files)
+}
+
+// noModTimeClient refuses to set mtime like backends without PROPPATCH
+type noModTimeClient struct {
+	*local.Client
+	calls int32
+}
+
+func (c *noModTimeClient) SetModTime(path string, modTime time.Time) error {
+	atomic.AddInt32(&c.calls, 1)
+	return client.ErrNotSupported
+}
+
+func TestOneWayKeepModTime(t *testing.T) {
+	modTime := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	files := map[string]string{"/a": "a", "/b": "b", "/c": "c"}
+
+	in, out := newTestDir(t), newTestDir(t)
+	defer os.RemoveAll(in)
+	defer os.RemoveAll(out)
+	writeTestFiles(t, in, files, modTime)
+	runTestOneWay(t, newTestClient(in), newTestClient(out), OneWayOpt{})
+	for path := range files {
+		info, err := os.Stat(filepath.Join(out, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(modTime) {
+			t.Errorf("%s: mtime %s, expected %s", path, info.ModTime(), modTime)
+		}
+	}
+
+	// unsupported mtime is asked once and is no upload error
+	unsupportedOut := newTestDir(t)
+	defer os.RemoveAll(unsupportedOut)
+	output := &noModTimeClient{Client: newTestClient(unsupportedOut)}
+	report := runTestOneWay(t, newTestClient(in), output, OneWayOpt{ThreadCount: 1})
+	if report.FilesUploaded != len(files) || report.Failed > 0 {
+		t.Fatalf("uploaded %d, failed %d", report.FilesUploaded, report.Failed)
+	}
+	if calls := atomic.LoadInt32(&output.calls); calls != 1 {
+		t.Fatalf("SetModTime called %d times, expected once", calls)
+	}
+	expectTestFiles(t, unsupportedOut, files)
+}
@@ -0,0 +1,228 @@
+package synchronizer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/io-developer/go-davsync/pkg/util"
+)
+
+// PlanOp is an operation kind of sync plan
+type PlanOp string
+
+// Plan operations
+const (
+	PlanMakeDir   = PlanOp("MakeDir")
+	PlanMove      = PlanOp("Move")
+	PlanCopy      = PlanOp("Copy")
+	PlanUpload    = PlanOp("Upload")
+	PlanDelete    = PlanOp("Delete")
+	PlanDeleteDir = PlanOp("DeleteDir")
+)
+
+// PlanItem is a single planned operation on output
+type PlanItem struct {
+	Op     PlanOp
+	Path   string
+	Src    string `json:",omitempty"`
+	Size   int64
+	Reason string
+}
+
+// Plan of sync. Phases are executed in the order of fields
+type Plan struct {
+	MakeDirs   []PlanItem
+	Moves      []PlanItem
+	Uploads    []PlanItem
+	Copies     []PlanItem
+	Deletes    []PlanItem
+	DeleteDirs []PlanItem
+}
+
+// Items returns all plan items in execution order
+func (p Plan) Items() []PlanItem {
+	items := []PlanItem{}
+	items = append(items, p.MakeDirs...)
+	items = append(items, p.Moves...)
+	items = append(items, p.Uploads...)
+	items = append(items, p.Copies...)
+	items = append(items, p.Deletes...)
+	items = append(items, p.DeleteDirs...)
+	return items
+}
+
+// IsEmpty reports whether there is nothing to do
+func (p Plan) IsEmpty() bool {
+	return len(p.Items()) == 0
+}
+
+// UploadSize is total size of files to upload
+func (p Plan) UploadSize() int64 {
+	return planItemsSize(p.Uploads)
+}
+
+// DeleteSize is total size of files to delete
+func (p Plan) DeleteSize() int64 {
+	return planItemsSize(p.Deletes)
+}
+
+// WriteText writes human-readable plan
+func (p Plan) WriteText(w io.Writer) error {
+	for _, item := range p.Items() {
+		line := fmt.Sprintf("%-9s %s", item.Op, item.Path)
+		if item.Src != "" {
+			line = fmt.Sprintf("%-9s %s -> %s", item.Op, item.Src, item.Path)
+		}
+		if item.Op != PlanMakeDir && item.Op != PlanDeleteDir {
+			line += fmt.Sprintf("  (%s)", util.FormatBytes(item.Size))
+		}
+		if item.Reason != "" {
+			line += fmt.Sprintf("  %s", item.Reason)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(
+		w,
+		"Total: %d dirs to make, %d files to move, %d files to upload (%s), %d files to copy, %d files to delete (%s), %d dirs to delete\n",
+		len(p.MakeDirs),
+		len(p.Moves),
+		len(p.Uploads),
+		util.FormatBytes(p.UploadSize()),
+		len(p.Copies),
+		len(p.Deletes),
+		util.FormatBytes(p.DeleteSize()),
+		len(p.DeleteDirs),
+	)
+	return err
+}
+
+func planItemsSize(items []PlanItem) int64 {
+	size := int64(0)
+	for _, item := range items {
+		size += item.Size
+	}
+	return size
+}
+
+func planItemPaths(items []PlanItem) []string {
+	paths := make([]string, len(items))
+	for i, item := range items {
+		paths[i] = item.Path
+	}
+	return paths
+}
+
+// hasPathUnder reports whether any of paths is inside dir
+func hasPathUnder(paths []string, dir string) bool {
+	for _, path := range paths {
+		if path != dir && strings.HasPrefix(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *OneWay) buildPlan() Plan {
+	plan := Plan{
+		MakeDirs:   []PlanItem{},
+		Moves:      []PlanItem{},
+		Uploads:    []PlanItem{},
+		Copies:     []PlanItem{},
+		Deletes:    []PlanItem{},
+		DeleteDirs: []PlanItem{},
+	}
+
+	bothPathDirs := util.PathSortedDirs(s.bothPaths)
+	addPathDirs := util.PathSortedDirs(s.addPaths)
+	_, addDirs, _ := util.Diff(addPathDirs, bothPathDirs)
+	for _, path := range util.PathSortedDirs(addDirs) {
+		plan.MakeDirs = append(plan.MakeDirs, PlanItem{
+			Op:     PlanMakeDir,
+			Path:   path,
+			Reason: "not in output",
+		})
+	}
+
+	movedSources := map[string]bool{}
+	for _, path := range util.PathSorted(s.addPaths) {
+		res, _ := s.inputTree.GetChild(path)
+		if res.IsDir {
+			continue
+		}
+		if srcPath, isMoved := s.moves[path]; isMoved {
+			movedSources[srcPath] = true
+			plan.Moves = append(plan.Moves, PlanItem{
+				Op:     PlanMove,
+				Path:   path,
+				Src:    srcPath,
+				Size:   res.Size,
+				Reason: "same content moved",
+			})
+			continue
+		}
+		if srcPath, isCopied := s.copies[path]; isCopied {
+			plan.Copies = append(plan.Copies, PlanItem{
+				Op:     PlanCopy,
+				Path:   path,
+				Src:    srcPath,
+				Size:   res.Size,
+				Reason: "same content on output",
+			})
+			continue
+		}
+		plan.Uploads = append(plan.Uploads, PlanItem{
+			Op:     PlanUpload,
+			Path:   path,
+			Size:   res.Size,
+			Reason: "new file",
+		})
+	}
+	for _, path := range util.PathSorted(s.changedPaths) {
+		res, _ := s.inputTree.GetChild(path)
+		plan.Uploads = append(plan.Uploads, PlanItem{
+			Op:     PlanUpload,
+			Path:   path,
+			Size:   res.Size,
+			Reason: s.changedReasons[path],
+		})
+	}
+
+	if s.opt.AllowDelete {
+		deleteReason := "not in input"
+		if s.opt.BackupDir != "" {
+			deleteReason = "not in input, moved to backup"
+		}
+		for _, path := range util.PathSorted(s.delPaths) {
+			res, _ := s.outputTree.GetChild(path)
+			if res.IsDir || movedSources[path] {
+				continue
+			}
+			plan.Deletes = append(plan.Deletes, PlanItem{
+				Op:     PlanDelete,
+				Path:   path,
+				Size:   res.Size,
+				Reason: deleteReason,
+			})
+		}
+	}
+
+	if s.opt.Mirror {
+		excluded := s.outputTree.GetExcludedPaths()
+		for _, path := range util.PathSortedDeepestFirst(s.delPaths) {
+			res, _ := s.outputTree.GetChild(path)
+			if !res.IsDir || hasPathUnder(excluded, path) {
+				continue
+			}
+			plan.DeleteDirs = append(plan.DeleteDirs, PlanItem{
+				Op:     PlanDeleteDir,
+				Path:   path,
+				Reason: "not in input",
+			})
+		}
+	}
+
+	return plan
+}
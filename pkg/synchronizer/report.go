@@ -0,0 +1,215 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/util"
+)
+
+// ReportState tells whether sync ran to the end
+type ReportState string
+
+// Report states
+const (
+	ReportComplete = ReportState("Complete")
+	ReportStopped  = ReportState("Stopped")
+	ReportAborted  = ReportState("Aborted")
+)
+
+// ReportStatus is an overall outcome of sync
+type ReportStatus string
+
+// Report statuses
+const (
+	ReportOK      = ReportStatus("OK")
+	ReportPartial = ReportStatus("PartialFailure")
+	ReportFailure = ReportStatus("Failure")
+)
+
+// PathError is a failed operation. Path is empty for tree-wide errors
+type PathError struct {
+	Op    string
+	Path  string
+	Error string
+}
+
+// SyncReport is a result of sync
+type SyncReport struct {
+	State      ReportState
+	StartedAt  time.Time
+	FinishedAt time.Time
+
+	PlanDuration    time.Duration
+	ExecuteDuration time.Duration
+
+	DirsCreated      int
+	FilesMoved       int
+	FilesCopied      int
+	FilesUploaded    int
+	FilesSkipped     int
+	FilesDeleted     int
+	FilesBackedUp    int
+	DirsDeleted      int
+	Failed           int
+	NotStarted       int
+	BytesTransferred int64
+
+	Errors []PathError
+}
+
+func newSyncReport() SyncReport {
+	return SyncReport{
+		State:     ReportComplete,
+		StartedAt: time.Now(),
+		Errors:    []PathError{},
+	}
+}
+
+// Succeeded is a number of completed operations
+func (r SyncReport) Succeeded() int {
+	return r.DirsCreated + r.FilesMoved + r.FilesCopied + r.FilesUploaded + r.FilesDeleted + r.DirsDeleted
+}
+
+// Status is OK only for complete run without errors
+func (r SyncReport) Status() ReportStatus {
+	if len(r.Errors) == 0 {
+		if r.State == ReportComplete {
+			return ReportOK
+		}
+		return ReportPartial
+	}
+	if r.Succeeded() == 0 {
+		return ReportFailure
+	}
+	return ReportPartial
+}
+
+// Merge adds counters and errors of other report
+func (r *SyncReport) Merge(other SyncReport) {
+	if r.StartedAt.IsZero() || (!other.StartedAt.IsZero() && other.StartedAt.Before(r.StartedAt)) {
+		r.StartedAt = other.StartedAt
+	}
+	if other.FinishedAt.After(r.FinishedAt) {
+		r.FinishedAt = other.FinishedAt
+	}
+	if other.State == ReportAborted || (other.State == ReportStopped && r.State != ReportAborted) {
+		r.State = other.State
+	}
+	r.PlanDuration += other.PlanDuration
+	r.ExecuteDuration += other.ExecuteDuration
+	r.DirsCreated += other.DirsCreated
+	r.FilesMoved += other.FilesMoved
+	r.FilesCopied += other.FilesCopied
+	r.FilesUploaded += other.FilesUploaded
+	r.FilesSkipped += other.FilesSkipped
+	r.FilesDeleted += other.FilesDeleted
+	r.FilesBackedUp += other.FilesBackedUp
+	r.DirsDeleted += other.DirsDeleted
+	r.Failed += other.Failed
+	r.NotStarted += other.NotStarted
+	r.BytesTransferred += other.BytesTransferred
+	r.Errors = append(r.Errors, other.Errors...)
+}
+
+func (r *SyncReport) addError(op, path string, err error) {
+	r.Errors = append(r.Errors, PathError{
+		Op:    op,
+		Path:  path,
+		Error: err.Error(),
+	})
+}
+
+// addResult counts handled paths, returns number of done ones
+func (r *SyncReport) addResult(op PlanOp, result *handleResult) int {
+	if result == nil {
+		return 0
+	}
+	for _, path := range util.PathSorted(result.failedPaths()) {
+		r.addError(string(op), path, result.Failed[path])
+	}
+	r.Failed += len(result.Failed)
+	r.NotStarted += len(result.Skipped)
+	return len(result.Done)
+}
+
+func (r *SyncReport) finish(ctx context.Context, stopped bool) {
+	r.FinishedAt = time.Now()
+	if ctx.Err() != nil {
+		r.State = ReportAborted
+	} else if stopped {
+		r.State = ReportStopped
+	}
+}
+
+// handleResult collects outcome of handled paths from all threads
+type handleResult struct {
+	mu sync.Mutex
+
+	Done    []string
+	Failed  map[string]error
+	Skipped []string
+}
+
+func newHandleResult() *handleResult {
+	return &handleResult{
+		Done:    []string{},
+		Failed:  map[string]error{},
+		Skipped: []string{},
+	}
+}
+
+func (r *handleResult) done(path string) {
+	r.mu.Lock()
+	r.Done = append(r.Done, path)
+	r.mu.Unlock()
+}
+
+func (r *handleResult) fail(path string, err error) {
+	r.mu.Lock()
+	r.Failed[path] = err
+	r.mu.Unlock()
+}
+
+func (r *handleResult) skip(paths ...string) {
+	r.mu.Lock()
+	r.Skipped = append(r.Skipped, paths...)
+	r.mu.Unlock()
+}
+
+func (r *handleResult) failedPaths() []string {
+	paths := []string{}
+	for path := range r.Failed {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// LogReport prints report summary via logFn
+func LogReport(r SyncReport, logFn func(msg string)) {
+	logFn(fmt.Sprintf("Summary (%s, %s):", r.State, r.Status()))
+	logFn(fmt.Sprintf(
+		"  dirs created %d, files moved %d, copied %d, uploaded %d (%s), skipped %d, deleted %d, backed up %d, dirs deleted %d",
+		r.DirsCreated,
+		r.FilesMoved,
+		r.FilesCopied,
+		r.FilesUploaded,
+		util.FormatBytes(r.BytesTransferred),
+		r.FilesSkipped,
+		r.FilesDeleted,
+		r.FilesBackedUp,
+		r.DirsDeleted,
+	))
+	logFn(fmt.Sprintf("  failed %d, not started %d", r.Failed, r.NotStarted))
+	logFn(fmt.Sprintf(
+		"  took %s (plan %s, execute %s)",
+		r.FinishedAt.Sub(r.StartedAt).Round(time.Millisecond),
+		r.PlanDuration.Round(time.Millisecond),
+		r.ExecuteDuration.Round(time.Millisecond),
+	))
+	for _, e := range r.Errors {
+		logFn(fmt.Sprintf("  ERR %s %s: %s", e.Op, e.Path, e.Error))
+	}
+}
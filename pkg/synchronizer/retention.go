@@ -0,0 +1,75 @@
+package synchronizer
+
+import (
+	"path"
+	"sort"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+)
+
+// datedDir is a dir named by time, like backup sets and snapshots
+type datedDir struct {
+	path string
+	time time.Time
+}
+
+func (d datedDir) name() string {
+	return path.Base(d.path)
+}
+
+// readDatedDirs lists subdirs of dir named by time format, newest first
+func readDatedDirs(reader client.DirReader, dir, format string) ([]datedDir, error) {
+	children, err := reader.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	dirs := []datedDir{}
+	for childPath, res := range children {
+		dirTime, err := time.ParseInLocation(format, path.Base(childPath), time.Local)
+		if err != nil || !res.IsDir {
+			continue
+		}
+		dirs = append(dirs, datedDir{childPath, dirTime})
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].time.After(dirs[j].time)
+	})
+	return dirs, nil
+}
+
+// expiredDirs picks dirs beyond keepCount newest ones or older than keepAge.
+// Zero limits keep everything, dir named keepName is never picked
+func expiredDirs(dirs []datedDir, keepCount int, keepAge time.Duration, keepName string) []datedDir {
+	expired := []datedDir{}
+	for i, dir := range dirs {
+		if dir.name() == keepName {
+			continue
+		}
+		tooMany := keepCount > 0 && i >= keepCount
+		tooOld := keepAge > 0 && time.Now().Sub(dir.time) > keepAge
+		if tooMany || tooOld {
+			expired = append(expired, dir)
+		}
+	}
+	return expired
+}
+
+// deleteTree deletes dir with everything inside, deepest first
+func deleteTree(c client.Client, reader client.DirReader, dir string) error {
+	children, err := reader.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for childPath, res := range children {
+		if res.IsDir {
+			err = deleteTree(c, reader, childPath)
+		} else {
+			err = c.DeleteFile(childPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return c.DeleteDir(dir)
+}
@@ -0,0 +1,106 @@
+package synchronizer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+)
+
+func TestExpiredDirs(t *testing.T) {
+	now := time.Now()
+	dirs := []datedDir{
+		{"/d0/", now.Add(-time.Minute)},
+		{"/d1/", now.Add(-time.Hour)},
+		{"/d2/", now.Add(-25 * time.Hour)},
+		{"/d3/", now.Add(-49 * time.Hour)},
+	}
+	tests := []struct {
+		name      string
+		keepCount int
+		keepAge   time.Duration
+		keepName  string
+		expired   []string
+	}{
+		{name: "no limits", expired: []string{}},
+		{name: "by count", keepCount: 2, expired: []string{"/d2/", "/d3/"}},
+		{name: "by age", keepAge: 24 * time.Hour, expired: []string{"/d2/", "/d3/"}},
+		{name: "by count and age", keepCount: 1, keepAge: 48 * time.Hour, expired: []string{"/d1/", "/d2/", "/d3/"}},
+		{name: "kept by name", keepCount: 1, keepName: "d2", expired: []string{"/d1/", "/d3/"}},
+	}
+	for _, test := range tests {
+		expired := expiredDirs(dirs, test.keepCount, test.keepAge, test.keepName)
+		paths := []string{}
+		for _, dir := range expired {
+			paths = append(paths, dir.path)
+		}
+		if len(paths) != len(test.expired) {
+			t.Errorf("%s: expired %v, expected %v", test.name, paths, test.expired)
+			continue
+		}
+		for i := range paths {
+			if paths[i] != test.expired[i] {
+				t.Errorf("%s: expired %v, expected %v", test.name, paths, test.expired)
+				break
+			}
+		}
+	}
+}
+
+func TestReadDatedDirs(t *testing.T) {
+	dir := newTestDir(t)
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"2026-10-15T02-00-00", "2026-10-16T02-00-00", "other"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestFiles(t, dir, map[string]string{"/2026-10-14T02-00-00": "not a dir"}, time.Time{})
+
+	dirs, err := readDatedDirs(newTestClient(dir), "/", BackupTimeFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != 2 || dirs[0].name() != "2026-10-16T02-00-00" || dirs[1].name() != "2026-10-15T02-00-00" {
+		t.Fatalf("dirs %v, expected the two dated ones, newest first", dirs)
+	}
+}
+
+func TestSnapshotReusedWithinSecond(t *testing.T) {
+	in, out := newTestDir(t), newTestDir(t)
+	defer os.RemoveAll(in)
+	defer os.RemoveAll(out)
+	subClient := func(dir string) (client.Client, error) {
+		return newTestClient(filepath.Join(out, dir)), nil
+	}
+	sync := func() SyncReport {
+		s := NewSnapshot(newTestClient(in), newTestClient(out), subClient, SnapshotOpt{}, OneWayOpt{ThreadCount: 1})
+		errors := make(chan error)
+		go func() {
+			for range errors {
+			}
+		}()
+		report := s.Sync(context.Background(), errors)
+		close(errors)
+		return report
+	}
+
+	// both runs start within the same second
+	time.Sleep(time.Now().Truncate(time.Second).Add(time.Second).Sub(time.Now()))
+	for i := 0; i < 2; i++ {
+		if report := sync(); len(report.Errors) > 0 {
+			t.Fatalf("run %d errors %v", i, report.Errors)
+		}
+	}
+	infos, err := ioutil.ReadDir(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || !infos[0].IsDir() {
+		t.Fatalf("%d snapshots, expected 1", len(infos))
+	}
+}
@@ -0,0 +1,232 @@
+package synchronizer
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+	"github.com/io-developer/go-davsync/pkg/util"
+)
+
+// QueueOrder decides which files are handed to threads first
+type QueueOrder string
+
+// Queue orders
+const (
+	QueuePath          = QueueOrder("Path")
+	QueueSmallestFirst = QueueOrder("SmallestFirst")
+	QueueLargestFirst  = QueueOrder("LargestFirst")
+	QueueNewestFirst   = QueueOrder("NewestFirst")
+)
+
+// QueueOrders lists all known orders
+var QueueOrders = []QueueOrder{
+	QueuePath,
+	QueueSmallestFirst,
+	QueueLargestFirst,
+	QueueNewestFirst,
+}
+
+// IsValid reports whether the order is known
+func (o QueueOrder) IsValid() bool {
+	for _, known := range QueueOrders {
+		if o == known {
+			return true
+		}
+	}
+	return false
+}
+
+// orderPaths sorts paths by resources of tree, path order breaks ties
+func orderPaths(paths []string, tree *client.TreeBuffer, order QueueOrder) []string {
+	sorted := util.PathSorted(paths)
+	if tree == nil || order == QueuePath {
+		return sorted
+	}
+	resources := make([]client.Resource, len(sorted))
+	for i, path := range sorted {
+		resources[i], _ = tree.GetChild(path)
+	}
+	var less func(a, b client.Resource) bool
+	switch order {
+	case QueueSmallestFirst:
+		less = func(a, b client.Resource) bool { return a.Size < b.Size }
+	case QueueLargestFirst:
+		less = func(a, b client.Resource) bool { return a.Size > b.Size }
+	case QueueNewestFirst:
+		less = func(a, b client.Resource) bool { return a.ModTime.After(b.ModTime) }
+	default:
+		return sorted
+	}
+	sort.Stable(resourceSorter{sorted, resources, less})
+	return sorted
+}
+
+type resourceSorter struct {
+	paths     []string
+	resources []client.Resource
+	less      func(a, b client.Resource) bool
+}
+
+func (s resourceSorter) Len() int {
+	return len(s.paths)
+}
+
+func (s resourceSorter) Less(i, j int) bool {
+	return s.less(s.resources[i], s.resources[j])
+}
+
+func (s resourceSorter) Swap(i, j int) {
+	s.paths[i], s.paths[j] = s.paths[j], s.paths[i]
+	s.resources[i], s.resources[j] = s.resources[j], s.resources[i]
+}
+
+// byteBudget is a weighted semaphore on bytes of files in flight.
+// Zero limit means no limit
+type byteBudget struct {
+	limit int64
+	used  int64
+	held  map[string]int64
+	mu    sync.Mutex
+	cond  *sync.Cond
+}
+
+func newByteBudget(limit int64) *byteBudget {
+	b := &byteBudget{
+		limit: limit,
+		held:  map[string]int64{},
+	}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// weigh caps file weight at the limit, so a file larger than
+// the whole budget still runs, but alone
+func (b *byteBudget) weigh(size int64) int64 {
+	if b.limit <= 0 || size <= 0 {
+		return 0
+	}
+	if size > b.limit {
+		return b.limit
+	}
+	return size
+}
+
+func (b *byteBudget) fits(weight int64) bool {
+	return b.limit <= 0 || b.used == 0 || b.used+weight <= b.limit
+}
+
+// take holds weight bytes for path, caller holds the lock
+func (b *byteBudget) take(path string, weight int64) {
+	if weight > 0 {
+		b.used += weight
+		b.held[path] = weight
+	}
+}
+
+// release returns bytes held by path, repeated calls do nothing
+func (b *byteBudget) release(path string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	weight, ok := b.held[path]
+	if !ok {
+		return
+	}
+	delete(b.held, path)
+	b.used -= weight
+	b.cond.Broadcast()
+}
+
+// maxHeadSkips bounds how many paths may pass the head of queue waiting for
+// room, after that nothing is taken until the head fits
+const maxHeadSkips = 16
+
+// pathQueue hands paths to threads in order, taking the first one
+// fitting the budget, so small files pass large ones waiting for room
+type pathQueue struct {
+	budget    *byteBudget
+	paths     []string
+	weights   map[string]int64
+	headSkips int
+	closed    bool
+}
+
+func newPathQueue(budget *byteBudget, paths []string, tree *client.TreeBuffer) *pathQueue {
+	q := &pathQueue{
+		budget:  budget,
+		paths:   paths,
+		weights: map[string]int64{},
+	}
+	if tree != nil {
+		for _, path := range paths {
+			if res, exists := tree.GetChild(path); exists && !res.IsDir {
+				q.weights[path] = budget.weigh(res.Size)
+			}
+		}
+	}
+	return q
+}
+
+// next blocks until a queued path fits the budget and takes its bytes.
+// It returns false when the queue is empty or closed
+func (q *pathQueue) next() (string, bool) {
+	b := q.budget
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		if q.closed || len(q.paths) == 0 {
+			return "", false
+		}
+		for i, path := range q.paths {
+			if i > 0 && q.headSkips >= maxHeadSkips {
+				break
+			}
+			weight := q.weights[path]
+			if !b.fits(weight) {
+				continue
+			}
+			q.paths = append(q.paths[:i], q.paths[i+1:]...)
+			if i == 0 {
+				q.headSkips = 0
+			} else {
+				q.headSkips++
+			}
+			b.take(path, weight)
+			return path, true
+		}
+		b.cond.Wait()
+	}
+}
+
+// retake blocks until bytes of a path released after a failed attempt
+// fit the budget again and holds them for the next attempt.
+// It returns false when the queue is closed meanwhile
+func (q *pathQueue) retake(path string) bool {
+	b := q.budget
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, held := b.held[path]; held {
+		return true
+	}
+	weight := q.weights[path]
+	for !b.fits(weight) {
+		if q.closed {
+			return false
+		}
+		b.cond.Wait()
+	}
+	b.take(path, weight)
+	return true
+}
+
+// close wakes waiting threads and returns paths never handed out
+func (q *pathQueue) close() []string {
+	b := q.budget
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rest := q.paths
+	q.paths = nil
+	q.closed = true
+	b.cond.Broadcast()
+	return rest
+}
@@ -0,0 +1,236 @@
+package synchronizer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+)
+
+func TestByteBudgetWeigh(t *testing.T) {
+	tests := []struct {
+		limit  int64
+		size   int64
+		weight int64
+	}{
+		{0, 100, 0},
+		{100, 0, 0},
+		{100, 30, 30},
+		{100, 60, 60},
+		{100, 100, 100},
+		{100, 500, 100},
+	}
+	for _, test := range tests {
+		if weight := newByteBudget(test.limit).weigh(test.size); weight != test.weight {
+			t.Errorf("limit %d size %d: weight %d, expected %d", test.limit, test.size, weight, test.weight)
+		}
+	}
+}
+
+func TestByteBudgetFits(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int64
+		used   int64
+		weight int64
+		fits   bool
+	}{
+		{"no limit", 0, 1000, 1000, true},
+		{"empty budget takes anything", 100, 0, 100, true},
+		{"room left", 100, 40, 60, true},
+		{"no room", 100, 60, 60, false},
+		{"large file waits for empty budget", 100, 1, 100, false},
+	}
+	for _, test := range tests {
+		b := newByteBudget(test.limit)
+		b.used = test.used
+		if fits := b.fits(test.weight); fits != test.fits {
+			t.Errorf("%s: fits %t, expected %t", test.name, fits, test.fits)
+		}
+	}
+}
+
+func newTestQueue(limit int64, sizes map[string]int64, paths ...string) *pathQueue {
+	children := map[string]client.Resource{}
+	for path, size := range sizes {
+		children[path] = client.Resource{Path: path, Size: size}
+	}
+	tree := client.NewTreeBuffer(nil)
+	tree.Load(children)
+	return newPathQueue(newByteBudget(limit), paths, tree)
+}
+
+func TestPathQueueNext(t *testing.T) {
+	q := newTestQueue(100, map[string]int64{"/a": 60, "/b": 60, "/c": 30, "/d": 10}, "/a", "/b", "/c", "/d")
+	expected := []string{"/a", "/c", "/d"}
+	for _, path := range expected {
+		got, ok := q.next()
+		if !ok || got != path {
+			t.Fatalf("next (%q, %t), expected %q", got, ok, path)
+		}
+	}
+	if q.budget.used != 100 {
+		t.Fatalf("used %d, expected 100", q.budget.used)
+	}
+
+	// /b waits for room
+	taken := make(chan string)
+	go func() {
+		path, _ := q.next()
+		taken <- path
+	}()
+	q.budget.release("/d")
+	q.budget.release("/d")
+	select {
+	case path := <-taken:
+		t.Fatalf("unexpected %q before room", path)
+	case <-time.After(20 * time.Millisecond):
+	}
+	q.budget.release("/a")
+	select {
+	case path := <-taken:
+		if path != "/b" {
+			t.Fatalf("next %q, expected /b", path)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("/b not taken after release")
+	}
+	// /c and /b held
+	if q.budget.used != 90 {
+		t.Fatalf("used %d, expected 90", q.budget.used)
+	}
+}
+
+func TestPathQueueLargeFileAlone(t *testing.T) {
+	q := newTestQueue(100, map[string]int64{"/large": 1000, "/small": 10}, "/small", "/large")
+	if path, _ := q.next(); path != "/small" {
+		t.Fatalf("next %q, expected /small", path)
+	}
+	taken := make(chan string)
+	go func() {
+		path, _ := q.next()
+		taken <- path
+	}()
+	select {
+	case path := <-taken:
+		t.Fatalf("unexpected %q next to held bytes", path)
+	case <-time.After(20 * time.Millisecond):
+	}
+	q.budget.release("/small")
+	if path := <-taken; path != "/large" {
+		t.Fatalf("next %q, expected /large", path)
+	}
+	if q.budget.used != 100 {
+		t.Fatalf("used %d, expected 100", q.budget.used)
+	}
+}
+
+func TestPathQueueRetake(t *testing.T) {
+	q := newTestQueue(100, map[string]int64{"/a": 70, "/b": 70}, "/a", "/b")
+	q.next()
+	q.retake("/a")
+	if q.budget.used != 70 {
+		t.Fatalf("retake of held path changed used to %d", q.budget.used)
+	}
+
+	// /a released its bytes on read, /b took them meanwhile
+	q.budget.release("/a")
+	q.next()
+	retaken := make(chan struct{})
+	go func() {
+		q.retake("/a")
+		close(retaken)
+	}()
+	select {
+	case <-retaken:
+		t.Fatal("retake exceeded the budget")
+	case <-time.After(20 * time.Millisecond):
+	}
+	q.budget.release("/b")
+	select {
+	case <-retaken:
+	case <-time.After(time.Second):
+		t.Fatal("retake not done after release")
+	}
+	if q.budget.used != 70 {
+		t.Fatalf("used %d, expected 70", q.budget.used)
+	}
+}
+
+func TestPathQueueHeadSkips(t *testing.T) {
+	sizes := map[string]int64{"/a": 10, "/large": 100}
+	paths := []string{"/a", "/large"}
+	for i := 0; i <= maxHeadSkips; i++ {
+		path := fmt.Sprintf("/small%02d", i)
+		sizes[path] = 1
+		paths = append(paths, path)
+	}
+	q := newTestQueue(100, sizes, paths...)
+	q.next()
+	for i := 0; i < maxHeadSkips; i++ {
+		if path, _ := q.next(); path != fmt.Sprintf("/small%02d", i) {
+			t.Fatalf("next %q, expected /small%02d", path, i)
+		}
+	}
+
+	// small files no longer pass the waiting large one
+	taken := make(chan string)
+	go func() {
+		path, _ := q.next()
+		taken <- path
+	}()
+	select {
+	case path := <-taken:
+		t.Fatalf("unexpected %q passing the head", path)
+	case <-time.After(20 * time.Millisecond):
+	}
+	q.budget.release("/a")
+	for i := 0; i < maxHeadSkips; i++ {
+		q.budget.release(fmt.Sprintf("/small%02d", i))
+	}
+	if path := <-taken; path != "/large" {
+		t.Fatalf("next %q, expected /large", path)
+	}
+	q.budget.release("/large")
+	if path, _ := q.next(); path != fmt.Sprintf("/small%02d", maxHeadSkips) {
+		t.Fatalf("next %q after the head", path)
+	}
+}
+
+func TestPathQueueRetakeClose(t *testing.T) {
+	q := newTestQueue(100, map[string]int64{"/a": 70, "/b": 70}, "/a", "/b")
+	q.next()
+	q.budget.release("/a")
+	q.next()
+	retaken := make(chan bool)
+	go func() {
+		retaken <- q.retake("/a")
+	}()
+	q.close()
+	select {
+	case ok := <-retaken:
+		if ok {
+			t.Fatal("retake succeeded after close")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("retake blocked after close")
+	}
+}
+
+func TestPathQueueClose(t *testing.T) {
+	q := newTestQueue(100, map[string]int64{"/a": 100, "/b": 100}, "/a", "/b")
+	q.next()
+	done := make(chan bool)
+	go func() {
+		_, ok := q.next()
+		done <- ok
+	}()
+	rest := q.close()
+	if ok := <-done; ok {
+		t.Fatal("next returned a path after close")
+	}
+	if len(rest) != 1 || rest[0] != "/b" {
+		t.Fatalf("rest %v, expected [/b]", rest)
+	}
+}
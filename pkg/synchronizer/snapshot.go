@@ -0,0 +1,168 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+	"github.com/io-developer/go-davsync/pkg/log"
+)
+
+// SnapshotTimeFormat names snapshot dirs, one per run
+const SnapshotTimeFormat = BackupTimeFormat
+
+type SnapshotOpt struct {
+	KeepCount int
+	KeepAge   time.Duration
+}
+
+// SubClientFn creates client of the same output rooted at dir
+type SubClientFn func(dir string) (client.Client, error)
+
+// Snapshot syncs input into new dated dir of output. The dir starts as
+// server-side copy of the previous snapshot, so only the diff is uploaded
+type Snapshot struct {
+	opt          SnapshotOpt
+	transferOpt  OneWayOpt
+	input        client.Client
+	output       client.Client
+	outputClient client.Client
+	subClient    SubClientFn
+	mu           sync.Mutex
+	transfer     *OneWay
+	stopped      bool
+}
+
+func NewSnapshot(input, output client.Client, subClient SubClientFn, opt SnapshotOpt, transferOpt OneWayOpt) *Snapshot {
+	transferOpt.Mirror = true
+	transferOpt.AllowDelete = true
+	transferOpt.ManifestPath = "" // every run writes into a new dir
+	transferOpt.JournalPath = ""
+	transferOpt.BackupDir = "" // previous snapshots keep old versions
+
+	return &Snapshot{
+		opt:          opt,
+		transferOpt:  transferOpt,
+		input:        input,
+		output:       output,
+		outputClient: output,
+		subClient:    subClient,
+	}
+}
+
+func (s *Snapshot) log(msg string) {
+	log.Info(fmt.Sprintf("Snapshot: %s", msg))
+}
+
+// Stop lets in-flight files finish but schedules no new ones
+func (s *Snapshot) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	if s.transfer != nil {
+		s.transfer.Stop()
+	}
+}
+
+// InFlight returns the current work of transfer threads
+func (s *Snapshot) InFlight() []log.ThreadLog {
+	s.mu.Lock()
+	transfer := s.transfer
+	s.mu.Unlock()
+	if transfer == nil {
+		return []log.ThreadLog{}
+	}
+	return transfer.InFlight()
+}
+
+func (s *Snapshot) Sync(ctx context.Context, errors chan<- error) SyncReport {
+	s.output = client.WithContext(s.outputClient, ctx)
+
+	report := newSyncReport()
+	fail := func(op string, err error) SyncReport {
+		errors <- err
+		report.addError(op, "", err)
+		report.finish(ctx, false)
+		LogReport(report, s.log)
+		return report
+	}
+
+	reader, ok := s.output.(client.DirReader)
+	if !ok {
+		return fail("Snapshot", fmt.Errorf("Snapshots are not supported by output client"))
+	}
+	snapshots, err := readDatedDirs(reader, "/", SnapshotTimeFormat)
+	if err != nil {
+		return fail("ReadSnapshots", err)
+	}
+
+	name := time.Now().Format(SnapshotTimeFormat)
+	dir := "/" + name + "/"
+	if len(snapshots) > 0 && snapshots[0].name() == name {
+		// previous run within the same second, its snapshot is updated
+		s.log(fmt.Sprintf("Reusing %s..", dir))
+	} else if len(snapshots) > 0 {
+		prev := snapshots[0].path
+		s.log(fmt.Sprintf("Copying %s to %s..", prev, dir))
+		err = s.output.CopyFile(prev, dir)
+		if err != nil {
+			return fail("CopySnapshot", err)
+		}
+	} else {
+		s.log(fmt.Sprintf("Making %s..", dir))
+		err = s.output.MakeDir(dir)
+		if err != nil && !s.isDir(dir) {
+			return fail("MakeSnapshot", err)
+		}
+	}
+
+	output, err := s.subClient(dir)
+	if err != nil {
+		return fail("MakeSnapshot", err)
+	}
+	transfer := NewOneWay(s.input, output, s.transferOpt)
+	s.mu.Lock()
+	s.transfer = transfer
+	if s.stopped {
+		transfer.Stop()
+	}
+	s.mu.Unlock()
+
+	report = transfer.Sync(ctx, errors)
+	if err := client.Close(output); err != nil {
+		s.log(fmt.Sprintf("Snapshot client closing error: %v", err))
+	}
+	if !transfer.isStopped(ctx) {
+		s.prune(reader, name, &report, errors)
+	}
+	return report
+}
+
+// isDir reports whether dir exists on output, e.g. made by a concurrent run
+func (s *Snapshot) isDir(dir string) bool {
+	res, exists, err := s.output.ReadResource(dir)
+	return err == nil && exists && res.IsDir
+}
+
+// prune deletes snapshots expired by retention, the current one is kept
+func (s *Snapshot) prune(reader client.DirReader, current string, report *SyncReport, errors chan<- error) {
+	if s.opt.KeepCount <= 0 && s.opt.KeepAge <= 0 {
+		return
+	}
+	snapshots, err := readDatedDirs(reader, "/", SnapshotTimeFormat)
+	if err != nil {
+		errors <- err
+		report.addError("PruneSnapshots", "", err)
+		return
+	}
+	for _, snapshot := range expiredDirs(snapshots, s.opt.KeepCount, s.opt.KeepAge, current) {
+		s.log(fmt.Sprintf("Deleting %s", snapshot.path))
+		err := deleteTree(s.output, reader, snapshot.path)
+		if err != nil {
+			errors <- err
+			report.addError("PruneSnapshots", snapshot.path, err)
+		}
+	}
+}
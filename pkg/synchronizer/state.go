@@ -0,0 +1,85 @@
+package synchronizer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+)
+
+// StateResource is a stored snapshot of resource
+type StateResource struct {
+	IsDir      bool
+	Size       int64
+	ModTime    time.Time
+	HashETag   string `json:",omitempty"`
+	HashMd5    string `json:",omitempty"`
+	HashSha256 string `json:",omitempty"`
+}
+
+// NewStateResource makes a snapshot of resource
+func NewStateResource(res client.Resource) StateResource {
+	return StateResource{
+		IsDir:      res.IsDir,
+		Size:       res.Size,
+		ModTime:    res.ModTime,
+		HashETag:   res.HashETag,
+		HashMd5:    res.HashMd5,
+		HashSha256: res.HashSha256,
+	}
+}
+
+// isSameVersion tells whether resource is still the file stored,
+// by ETag if known or by mtime otherwise
+func (r StateResource) isSameVersion(res client.Resource) bool {
+	if r.IsDir != res.IsDir || r.Size != res.Size {
+		return false
+	}
+	if r.HashETag != "" || res.HashETag != "" {
+		return r.HashETag == res.HashETag
+	}
+	return r.ModTime.Equal(res.ModTime)
+}
+
+// ToResource restores resource from snapshot
+func (r StateResource) ToResource(path string) client.Resource {
+	return client.Resource{
+		Path:       path,
+		Name:       filepath.Base(path),
+		IsDir:      r.IsDir,
+		Size:       r.Size,
+		ModTime:    r.ModTime,
+		HashETag:   r.HashETag,
+		HashMd5:    r.HashMd5,
+		HashSha256: r.HashSha256,
+	}
+}
+
+// readJSONFile returns exists=false if file is missing
+func readJSONFile(path string, v interface{}) (exists bool, err error) {
+	bytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(bytes, v)
+}
+
+// writeJSONFile writes via temporary file to never leave a truncated one
+func writeJSONFile(path string, v interface{}) error {
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	err = ioutil.WriteFile(tmpPath, bytes, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
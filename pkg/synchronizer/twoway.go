@@ -0,0 +1,630 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+	"github.com/io-developer/go-davsync/pkg/log"
+	"github.com/io-developer/go-davsync/pkg/util"
+)
+
+// ConflictPolicy resolves files changed on both sides since last sync
+type ConflictPolicy string
+
+// Conflict policies
+const (
+	ConflictKeepNewer    = ConflictPolicy("KeepNewer")
+	ConflictKeepBoth     = ConflictPolicy("KeepBoth")
+	ConflictPreferInput  = ConflictPolicy("PreferInput")
+	ConflictPreferOutput = ConflictPolicy("PreferOutput")
+)
+
+// IsValid reports whether the policy is known
+func (p ConflictPolicy) IsValid() bool {
+	switch p {
+	case ConflictKeepNewer, ConflictKeepBoth, ConflictPreferInput, ConflictPreferOutput:
+		return true
+	}
+	return false
+}
+
+type TwoWayOpt struct {
+	StatePath    string
+	Conflict     ConflictPolicy
+	ModifyWindow time.Duration
+}
+
+// TwoWayState is the last synced tree
+type TwoWayState struct {
+	SavedAt time.Time
+	Input   string
+	Output  string
+	Entries map[string]TwoWayStateEntry
+}
+
+// TwoWayStateEntry is a path snapshot of both sides
+type TwoWayStateEntry struct {
+	Input  StateResource
+	Output StateResource
+}
+
+type sideChange string
+
+const (
+	sideAbsent    = sideChange("absent")
+	sideUnchanged = sideChange("unchanged")
+	sideAdded     = sideChange("added")
+	sideModified  = sideChange("modified")
+	sideDeleted   = sideChange("deleted")
+)
+
+func (c sideChange) isChanged() bool {
+	return c == sideAdded || c == sideModified
+}
+
+// TwoWay propagates adds, edits and deletes in both directions.
+// Transfers are made by a pair of OneWay sharing the trees
+type TwoWay struct {
+	opt          TwoWayOpt
+	input        client.Client
+	output       client.Client
+	inputClient  client.Client
+	outputClient client.Client
+
+	inputTree  *client.TreeBuffer
+	outputTree *client.TreeBuffer
+
+	push *OneWay
+	pull *OneWay
+
+	state   TwoWayState
+	touched map[string]bool
+
+	pushDirs      []string
+	pullDirs      []string
+	pushFiles     []string
+	pullFiles     []string
+	delOutput     []string
+	delInput      []string
+	delOutputDirs []string
+	delInputDirs  []string
+	keepBoth      []string
+	keepBothNow   time.Time
+}
+
+func NewTwoWay(input, output client.Client, opt TwoWayOpt, transferOpt OneWayOpt) *TwoWay {
+	if opt.StatePath == "" {
+		opt.StatePath = ".davsync-state.json"
+	}
+	if opt.Conflict == "" {
+		opt.Conflict = ConflictKeepNewer
+	}
+	transferOpt.AllowDelete = true
+	transferOpt.Mirror = true
+	transferOpt.ManifestPath = "" // own state is used instead
+	transferOpt.JournalPath = ""
+	transferOpt.BackupDir = ""
+
+	push := NewOneWay(input, output, transferOpt)
+	pull := NewOneWay(output, input, transferOpt)
+	pull.inputTree = push.outputTree
+	pull.outputTree = push.inputTree
+
+	return &TwoWay{
+		opt:          opt,
+		input:        input,
+		output:       output,
+		inputClient:  input,
+		outputClient: output,
+		inputTree:    push.inputTree,
+		outputTree:   push.outputTree,
+		push:         push,
+		pull:         pull,
+	}
+}
+
+func (s *TwoWay) log(msg string) {
+	log.Info(fmt.Sprintf("TwoWay: %s", msg))
+}
+
+// Stop lets in-flight files finish but schedules no new ones
+func (s *TwoWay) Stop() {
+	s.push.Stop()
+	s.pull.Stop()
+}
+
+// InFlight returns the current work of push and pull threads
+func (s *TwoWay) InFlight() []log.ThreadLog {
+	return append(s.push.InFlight(), s.pull.InFlight()...)
+}
+
+func (s *TwoWay) Sync(ctx context.Context, errors chan<- error) SyncReport {
+	s.input = client.WithContext(s.inputClient, ctx)
+	s.output = client.WithContext(s.outputClient, ctx)
+	s.inputTree.SetClient(s.input)
+	s.outputTree.SetClient(s.output)
+
+	report := newSyncReport()
+	fail := func(op string, err error) SyncReport {
+		errors <- err
+		report.addError(op, "", err)
+		report.finish(ctx, false)
+		LogReport(report, s.log)
+		return report
+	}
+
+	err := s.loadState()
+	if err != nil {
+		return fail("LoadState", err)
+	}
+	err = s.readTrees()
+	if err != nil {
+		return fail("ReadTrees", err)
+	}
+
+	s.calcChanges()
+	s.keepBothRename(ctx, &report, errors)
+	report.PlanDuration = time.Now().Sub(report.StartedAt)
+
+	// keep dirs receiving new files from the other side
+	s.delOutputDirs = withoutParentsOf(s.delOutputDirs, append(s.pullDirs, s.pullFiles...))
+	s.delInputDirs = withoutParentsOf(s.delInputDirs, append(s.pushDirs, s.pushFiles...))
+
+	s.log("Pushing input -> output...")
+	report.Merge(s.push.Execute(ctx, s.makePlan(s.inputTree, s.outputTree, s.pushDirs, s.pushFiles, s.delOutput, s.delOutputDirs), errors))
+
+	s.log("Pulling output -> input...")
+	report.Merge(s.pull.Execute(ctx, s.makePlan(s.outputTree, s.inputTree, s.pullDirs, s.pullFiles, s.delInput, s.delInputDirs), errors))
+
+	s.updateState()
+	err = s.saveState()
+	if err != nil {
+		errors <- err
+		report.addError("SaveState", "", err)
+	}
+
+	report.FinishedAt = time.Now()
+	s.log("Both directions:")
+	LogReport(report, s.log)
+	return report
+}
+
+func (s *TwoWay) loadState() error {
+	s.state = TwoWayState{}
+	exists, err := readJSONFile(s.opt.StatePath, &s.state)
+	if err != nil {
+		return err
+	}
+	inputBase := s.input.ToAbsPath("/")
+	outputBase := s.output.ToAbsPath("/")
+	if !exists {
+		s.log(fmt.Sprintf("State '%s' not found, first sync", s.opt.StatePath))
+		s.state = TwoWayState{
+			Input:   inputBase,
+			Output:  outputBase,
+			Entries: map[string]TwoWayStateEntry{},
+		}
+		return nil
+	}
+	if s.state.Input != inputBase || s.state.Output != outputBase {
+		return fmt.Errorf(
+			"State '%s' belongs to other dirs (%s -> %s), expected (%s -> %s)",
+			s.opt.StatePath,
+			s.state.Input,
+			s.state.Output,
+			inputBase,
+			outputBase,
+		)
+	}
+	if s.state.Entries == nil {
+		s.state.Entries = map[string]TwoWayStateEntry{}
+	}
+	s.log(fmt.Sprintf("State '%s' loaded, %d entries, saved at %s", s.opt.StatePath, len(s.state.Entries), s.state.SavedAt))
+	return nil
+}
+
+func (s *TwoWay) saveState() error {
+	s.state.SavedAt = time.Now()
+	s.log(fmt.Sprintf("Saving state '%s', %d entries", s.opt.StatePath, len(s.state.Entries)))
+	return writeJSONFile(s.opt.StatePath, s.state)
+}
+
+// readTrees fails on any error: a partially read tree looks like deleted files
+func (s *TwoWay) readTrees() error {
+	var inputErr, outputErr error
+	group := sync.WaitGroup{}
+	group.Add(2)
+	go func() {
+		inputErr = s.inputTree.Read()
+		group.Done()
+	}()
+	go func() {
+		outputErr = s.outputTree.Read()
+		group.Done()
+	}()
+	group.Wait()
+	if inputErr != nil {
+		return inputErr
+	}
+	return outputErr
+}
+
+func (s *TwoWay) sideChange(res client.Resource, exists bool, stored StateResource, stateExists bool) sideChange {
+	if !exists {
+		if stateExists {
+			return sideDeleted
+		}
+		return sideAbsent
+	}
+	if !stateExists {
+		return sideAdded
+	}
+	if res.IsDir || stored.IsDir {
+		if res.IsDir == stored.IsDir {
+			return sideUnchanged
+		}
+		return sideModified
+	}
+	if res.Size != stored.Size {
+		return sideModified
+	}
+	if matched, comparable := compareStoredHashes(res, stored); comparable {
+		if matched {
+			return sideUnchanged
+		}
+		return sideModified
+	}
+	diff := res.ModTime.Sub(stored.ModTime)
+	if diff > s.opt.ModifyWindow || -diff > s.opt.ModifyWindow {
+		return sideModified
+	}
+	return sideUnchanged
+}
+
+// compareStoredHashes compares the same side, so ETags are reliable here
+func compareStoredHashes(res client.Resource, stored StateResource) (matched bool, comparable bool) {
+	if res.HashSha256 != "" && stored.HashSha256 != "" {
+		return res.HashSha256 == stored.HashSha256, true
+	}
+	if res.HashMd5 != "" && stored.HashMd5 != "" {
+		return res.HashMd5 == stored.HashMd5, true
+	}
+	if res.HashETag != "" && stored.HashETag != "" {
+		return res.HashETag == stored.HashETag, true
+	}
+	return false, false
+}
+
+func (s *TwoWay) calcChanges() {
+	s.log(fmt.Sprintf("Calculating changes, conflict policy '%s'...", s.opt.Conflict))
+
+	s.touched = map[string]bool{}
+	s.pushDirs = []string{}
+	s.pullDirs = []string{}
+	s.pushFiles = []string{}
+	s.pullFiles = []string{}
+	s.delOutput = []string{}
+	s.delInput = []string{}
+	s.delOutputDirs = []string{}
+	s.delInputDirs = []string{}
+	s.keepBoth = []string{}
+
+	pathDict := map[string]bool{}
+	for path := range s.inputTree.GetChildren() {
+		pathDict[path] = true
+	}
+	for path := range s.outputTree.GetChildren() {
+		pathDict[path] = true
+	}
+	for path := range s.state.Entries {
+		pathDict[path] = true
+	}
+	paths := []string{}
+	for path := range pathDict {
+		paths = append(paths, path)
+	}
+
+	for _, path := range util.PathSorted(paths) {
+		if path == "/" || s.inputTree.IsExcluded(path) || s.outputTree.IsExcluded(path) {
+			continue
+		}
+		in, inExists := s.inputTree.GetChild(path)
+		out, outExists := s.outputTree.GetChild(path)
+		entry, stateExists := s.state.Entries[path]
+		if stateExists && !s.push.opt.Filter.Match(path, entry.Input.ToResource(path)) {
+			continue
+		}
+
+		inChange := s.sideChange(in, inExists, entry.Input, stateExists)
+		outChange := s.sideChange(out, outExists, entry.Output, stateExists)
+		if inChange == sideUnchanged && outChange == sideUnchanged {
+			continue
+		}
+		if inChange == sideDeleted && outChange == sideDeleted {
+			s.touched[path] = true
+			continue
+		}
+		s.log(fmt.Sprintf("%s input %s, output %s", path, inChange, outChange))
+
+		if (inExists && in.IsDir) || (outExists && out.IsDir) {
+			s.calcDirChange(path, in, inExists, inChange, out, outExists, outChange)
+			continue
+		}
+		s.calcFileChange(path, in, inChange, out, outChange)
+	}
+}
+
+func (s *TwoWay) calcDirChange(
+	path string,
+	in client.Resource, inExists bool, inChange sideChange,
+	out client.Resource, outExists bool, outChange sideChange,
+) {
+	if inExists && outExists {
+		if in.IsDir != out.IsDir {
+			s.log(fmt.Sprintf("  SKIP: type mismatch, input dir %t, output dir %t", in.IsDir, out.IsDir))
+			return
+		}
+		s.touched[path] = true
+		return
+	}
+	if inExists && !outExists && inChange != sideUnchanged {
+		s.log("  make dir on output")
+		s.pushDirs = append(s.pushDirs, path)
+		s.touched[path] = true
+		return
+	}
+	if outExists && !inExists && outChange != sideUnchanged {
+		s.log("  make dir on input")
+		s.pullDirs = append(s.pullDirs, path)
+		s.touched[path] = true
+		return
+	}
+	if inChange == sideDeleted && outExists {
+		s.log("  delete dir on output")
+		s.delOutputDirs = append(s.delOutputDirs, path)
+		s.touched[path] = true
+		return
+	}
+	if outChange == sideDeleted && inExists {
+		s.log("  delete dir on input")
+		s.delInputDirs = append(s.delInputDirs, path)
+		s.touched[path] = true
+		return
+	}
+	s.log("  SKIP: unexpected dir change")
+}
+
+func withoutParentsOf(dirs, paths []string) []string {
+	result := []string{}
+	for _, dir := range dirs {
+		isParent := false
+		for _, path := range paths {
+			if strings.HasPrefix(path, dir) {
+				isParent = true
+				break
+			}
+		}
+		if !isParent {
+			result = append(result, dir)
+		}
+	}
+	return result
+}
+
+func (s *TwoWay) calcFileChange(path string, in client.Resource, inChange sideChange, out client.Resource, outChange sideChange) {
+	s.touched[path] = true
+
+	switch {
+	case inChange.isChanged() && (outChange == sideUnchanged || outChange == sideAbsent):
+		s.pushFiles = append(s.pushFiles, path)
+		return
+	case outChange.isChanged() && (inChange == sideUnchanged || inChange == sideAbsent):
+		s.pullFiles = append(s.pullFiles, path)
+		return
+	case inChange == sideDeleted && outChange == sideUnchanged:
+		s.delOutput = append(s.delOutput, path)
+		return
+	case outChange == sideDeleted && inChange == sideUnchanged:
+		s.delInput = append(s.delInput, path)
+		return
+	case inChange.isChanged() && outChange.isChanged():
+		if s.isSameContent(path, in, out) {
+			s.log("  same content on both sides")
+			return
+		}
+	}
+	s.resolveConflict(path, in, inChange, out, outChange)
+}
+
+func (s *TwoWay) resolveConflict(path string, in client.Resource, inChange sideChange, out client.Resource, outChange sideChange) {
+	preferInput := true
+	switch s.opt.Conflict {
+	case ConflictPreferInput:
+		preferInput = true
+	case ConflictPreferOutput:
+		preferInput = false
+	default:
+		if inChange == sideDeleted || outChange == sideDeleted {
+			// edit wins over delete to never lose data
+			preferInput = outChange == sideDeleted
+		} else if s.opt.Conflict == ConflictKeepBoth {
+			s.log("  CONFLICT: keeping both")
+			s.keepBoth = append(s.keepBoth, path)
+			return
+		} else {
+			preferInput = !out.ModTime.After(in.ModTime)
+		}
+	}
+	if preferInput {
+		s.log("  CONFLICT: input wins")
+		if inChange == sideDeleted {
+			s.delOutput = append(s.delOutput, path)
+		} else {
+			s.pushFiles = append(s.pushFiles, path)
+		}
+		return
+	}
+	s.log("  CONFLICT: output wins")
+	if outChange == sideDeleted {
+		s.delInput = append(s.delInput, path)
+	} else {
+		s.pullFiles = append(s.pullFiles, path)
+	}
+}
+
+// isSameContent compares by size and hashes, hashing local files if needed
+func (s *TwoWay) isSameContent(path string, in, out client.Resource) bool {
+	if in.Size != out.Size {
+		return false
+	}
+	if matched, comparable := compareHashes(in, out); comparable {
+		return matched
+	}
+	var err error
+	if in.IsLocal() {
+		in, err = hashResource(s.input, path, in, s.remoteLimiter(in))
+	}
+	if err == nil && out.IsLocal() {
+		out, err = hashResource(s.output, path, out, s.remoteLimiter(out))
+	}
+	if err != nil {
+		s.log(fmt.Sprintf("  hashing error: %v", err))
+		return false
+	}
+	matched, comparable := compareHashes(in, out)
+	return comparable && matched
+}
+
+// remoteLimiter limits reading of non-local resources only
+func (s *TwoWay) remoteLimiter(res client.Resource) *util.Limiter {
+	if res.IsLocal() {
+		return nil
+	}
+	return s.push.opt.Limiter
+}
+
+func conflictPath(path, side string, t time.Time) string {
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	return fmt.Sprintf("%s.conflict-%s-%s%s", base, side, t.Format("20060102-150405"), ext)
+}
+
+// keepBothRename moves output version aside, so it is pulled under a new name
+// and input version is pushed to the original path
+func (s *TwoWay) keepBothRename(ctx context.Context, report *SyncReport, errors chan<- error) {
+	s.keepBothNow = time.Now()
+	for _, path := range s.keepBoth {
+		if s.push.isStopped(ctx) {
+			break
+		}
+		copyPath := conflictPath(path, "output", s.keepBothNow)
+		s.log(fmt.Sprintf("Renaming output %s -> %s", path, copyPath))
+
+		err := s.output.MoveFile(path, copyPath)
+		if err != nil {
+			errors <- err
+			report.addError("ConflictRename", path, err)
+			report.Failed++
+			continue
+		}
+		out, _ := s.outputTree.GetChild(path)
+		out.Path = copyPath
+		out.Name = filepath.Base(copyPath)
+		s.outputTree.SetChild(copyPath, out)
+
+		s.touched[copyPath] = true
+		s.pullFiles = append(s.pullFiles, copyPath)
+		s.pushFiles = append(s.pushFiles, path)
+	}
+}
+
+func (s *TwoWay) makePlan(src, dst *client.TreeBuffer, dirs, files, deletes, deleteDirs []string) Plan {
+	plan := Plan{
+		MakeDirs:   []PlanItem{},
+		Uploads:    []PlanItem{},
+		Deletes:    []PlanItem{},
+		DeleteDirs: []PlanItem{},
+	}
+	dirs = append(util.PathSortedDirs(files), dirs...)
+	for _, path := range util.PathSortedDirs(dirs) {
+		plan.MakeDirs = append(plan.MakeDirs, PlanItem{Op: PlanMakeDir, Path: path})
+	}
+	for _, path := range util.PathSorted(files) {
+		res, _ := src.GetChild(path)
+		plan.Uploads = append(plan.Uploads, PlanItem{Op: PlanUpload, Path: path, Size: res.Size})
+	}
+	for _, path := range util.PathSorted(deletes) {
+		res, _ := dst.GetChild(path)
+		plan.Deletes = append(plan.Deletes, PlanItem{Op: PlanDelete, Path: path, Size: res.Size})
+	}
+	excluded := dst.GetExcludedPaths()
+	for _, path := range util.PathSortedDeepestFirst(deleteDirs) {
+		if hasPathUnder(excluded, path) {
+			continue
+		}
+		plan.DeleteDirs = append(plan.DeleteDirs, PlanItem{Op: PlanDeleteDir, Path: path})
+	}
+	return plan
+}
+
+// updateState records the current snapshot of untouched paths and
+// re-reads touched ones, so failed operations are retried next time
+func (s *TwoWay) updateState() {
+	s.log("Updating state...")
+
+	entries := map[string]TwoWayStateEntry{}
+	for path, in := range s.inputTree.GetChildren() {
+		if s.touched[path] {
+			continue
+		}
+		out, exists := s.outputTree.GetChild(path)
+		if exists && in.IsDir == out.IsDir {
+			entries[path] = TwoWayStateEntry{
+				Input:  NewStateResource(in),
+				Output: NewStateResource(out),
+			}
+		} else if entry, stored := s.state.Entries[path]; stored {
+			entries[path] = entry
+		}
+	}
+	for path, entry := range s.state.Entries {
+		if _, exists := entries[path]; !exists && !s.touched[path] {
+			if _, inExists := s.inputTree.GetChild(path); !inExists {
+				entries[path] = entry
+			}
+		}
+	}
+
+	for path := range s.touched {
+		in, inExists, inErr := s.input.ReadResource(path)
+		out, outExists, outErr := s.output.ReadResource(path)
+		if inErr != nil || outErr != nil {
+			s.log(fmt.Sprintf("  %s re-read error, keeping previous state", path))
+			if entry, stored := s.state.Entries[path]; stored {
+				entries[path] = entry
+			}
+			continue
+		}
+		if !inExists && !outExists {
+			continue
+		}
+		synced := inExists && outExists && in.IsDir == out.IsDir && (in.IsDir || in.Size == out.Size)
+		if synced {
+			entries[path] = TwoWayStateEntry{
+				Input:  NewStateResource(in),
+				Output: NewStateResource(out),
+			}
+			continue
+		}
+		if entry, stored := s.state.Entries[path]; stored {
+			entries[path] = entry
+		}
+	}
+
+	s.state.Entries = entries
+}
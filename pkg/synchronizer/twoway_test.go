@@ -0,0 +1,166 @@
+package synchronizer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func runTestTwoWay(t *testing.T, in, out, statePath string, opt TwoWayOpt) SyncReport {
+	t.Helper()
+	opt.StatePath = statePath
+	s := NewTwoWay(newTestClient(in), newTestClient(out), opt, OneWayOpt{ThreadCount: 2})
+	errors := make(chan error)
+	go func() {
+		for range errors {
+		}
+	}()
+	report := s.Sync(context.Background(), errors)
+	close(errors)
+	return report
+}
+
+func removeTestFiles(t *testing.T, dir string, paths []string) {
+	for _, path := range paths {
+		if err := os.Remove(filepath.Join(dir, filepath.FromSlash(path))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTwoWay(t *testing.T) {
+	synced := time.Now().Add(-time.Hour).Truncate(time.Second)
+	tests := []struct {
+		name      string
+		conflict  ConflictPolicy
+		first     map[string]string
+		input     map[string]string
+		output    map[string]string
+		inputMod  time.Time
+		outputMod time.Time
+		inputDel  []string
+		outputDel []string
+		expected  map[string]string
+	}{
+		{
+			name:     "first run without state",
+			input:    map[string]string{"/a": "a"},
+			output:   map[string]string{"/b": "b", "/c": "c"},
+			expected: map[string]string{"/a": "a", "/b": "b", "/c": "c"},
+		},
+		{
+			name:     "first run same content",
+			input:    map[string]string{"/a": "same"},
+			output:   map[string]string{"/a": "same"},
+			expected: map[string]string{"/a": "same"},
+		},
+		{
+			name:      "modified on both sides keeps newer",
+			first:     map[string]string{"/f": "v1"},
+			input:     map[string]string{"/f": "input v2"},
+			output:    map[string]string{"/f": "output v2!"},
+			inputMod:  synced.Add(10 * time.Minute),
+			outputMod: synced.Add(20 * time.Minute),
+			expected:  map[string]string{"/f": "output v2!"},
+		},
+		{
+			name:      "modified on both sides prefers input",
+			conflict:  ConflictPreferInput,
+			first:     map[string]string{"/f": "v1"},
+			input:     map[string]string{"/f": "input v2"},
+			output:    map[string]string{"/f": "output v2!"},
+			inputMod:  synced.Add(10 * time.Minute),
+			outputMod: synced.Add(20 * time.Minute),
+			expected:  map[string]string{"/f": "input v2"},
+		},
+		{
+			name:      "modified on input only",
+			first:     map[string]string{"/f": "v1", "/g": "g"},
+			input:     map[string]string{"/f": "input v2"},
+			inputMod:  synced.Add(10 * time.Minute),
+			outputMod: synced.Add(10 * time.Minute),
+			expected:  map[string]string{"/f": "input v2", "/g": "g"},
+		},
+		{
+			name:      "deleted on input, modified on output",
+			first:     map[string]string{"/f": "v1"},
+			output:    map[string]string{"/f": "output v2"},
+			outputMod: synced.Add(10 * time.Minute),
+			inputDel:  []string{"/f"},
+			expected:  map[string]string{"/f": "output v2"},
+		},
+		{
+			name:      "deleted on output, unchanged on input",
+			first:     map[string]string{"/f": "v1", "/g": "g"},
+			outputDel: []string{"/f"},
+			expected:  map[string]string{"/g": "g"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in, out, stateDir := newTestDir(t), newTestDir(t), newTestDir(t)
+			defer os.RemoveAll(in)
+			defer os.RemoveAll(out)
+			defer os.RemoveAll(stateDir)
+			statePath := filepath.Join(stateDir, "state.json")
+			opt := TwoWayOpt{Conflict: test.conflict}
+
+			if test.first != nil {
+				writeTestFiles(t, in, test.first, synced)
+				writeTestFiles(t, out, test.first, synced)
+				runTestTwoWay(t, in, out, statePath, opt)
+			}
+			writeTestFiles(t, in, test.input, test.inputMod)
+			writeTestFiles(t, out, test.output, test.outputMod)
+			removeTestFiles(t, in, test.inputDel)
+			removeTestFiles(t, out, test.outputDel)
+
+			report := runTestTwoWay(t, in, out, statePath, opt)
+			if report.Failed > 0 {
+				t.Fatalf("%d failed", report.Failed)
+			}
+			expectTestFiles(t, in, test.expected)
+			expectTestFiles(t, out, test.expected)
+		})
+	}
+}
+
+func TestTwoWayState(t *testing.T) {
+	in, out, stateDir := newTestDir(t), newTestDir(t), newTestDir(t)
+	defer os.RemoveAll(in)
+	defer os.RemoveAll(out)
+	defer os.RemoveAll(stateDir)
+	statePath := filepath.Join(stateDir, "state.json")
+	writeTestFiles(t, in, map[string]string{"/a": "a", "/sub/b": "b"}, time.Time{})
+
+	runTestTwoWay(t, in, out, statePath, TwoWayOpt{})
+	state := TwoWayState{}
+	exists, err := readJSONFile(statePath, &state)
+	if err != nil || !exists {
+		t.Fatalf("state not saved, exists %t, err %v", exists, err)
+	}
+	if state.Input != newTestClient(in).ToAbsPath("/") || state.Output != newTestClient(out).ToAbsPath("/") {
+		t.Fatalf("state of dirs %s -> %s", state.Input, state.Output)
+	}
+	for _, path := range []string{"/a", "/sub/", "/sub/b"} {
+		if _, exists := state.Entries[path]; !exists {
+			t.Errorf("%s not in state", path)
+		}
+	}
+
+	// loaded state leaves nothing to do
+	report := runTestTwoWay(t, in, out, statePath, TwoWayOpt{})
+	if report.FilesUploaded > 0 || report.FilesDeleted > 0 || report.Failed > 0 {
+		t.Fatalf("uploaded %d, deleted %d, failed %d", report.FilesUploaded, report.FilesDeleted, report.Failed)
+	}
+
+	// state of other dirs is refused
+	other := newTestDir(t)
+	defer os.RemoveAll(other)
+	report = runTestTwoWay(t, other, out, statePath, TwoWayOpt{})
+	if len(report.Errors) == 0 {
+		t.Fatal("state of other dirs is loaded")
+	}
+}
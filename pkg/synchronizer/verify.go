@@ -0,0 +1,357 @@
+package synchronizer
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+	"github.com/io-developer/go-davsync/pkg/filter"
+	"github.com/io-developer/go-davsync/pkg/log"
+	"github.com/io-developer/go-davsync/pkg/util"
+)
+
+// VerifyStatus of a file compared by Verify
+type VerifyStatus string
+
+// Verify statuses
+const (
+	VerifyMissing      = VerifyStatus("Missing")
+	VerifyExtra        = VerifyStatus("Extra")
+	VerifySizeMismatch = VerifyStatus("SizeMismatch")
+	VerifyHashMismatch = VerifyStatus("HashMismatch")
+	VerifyUnverified   = VerifyStatus("Unverified")
+	VerifyError        = VerifyStatus("Error")
+)
+
+type VerifyOpt struct {
+	// Download output files exposing no comparable checksum and hash them
+	Download    bool
+	ThreadCount uint
+	Filter      *filter.Filter `json:"-"`
+	Limiter     *util.Limiter  `json:"-"`
+}
+
+// VerifyItem is a file which is not proven intact
+type VerifyItem struct {
+	Path   string
+	Status VerifyStatus
+	Detail string `json:",omitempty"`
+}
+
+// VerifyReport lists files differing between input and output
+type VerifyReport struct {
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	State       ReportState
+	InputFiles  int
+	OutputFiles int
+	Matched     int
+	Items       []VerifyItem
+	Errors      []PathError
+}
+
+// Count returns number of items of status
+func (r VerifyReport) Count(status VerifyStatus) int {
+	count := 0
+	for _, item := range r.Items {
+		if item.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// HasDifferences reports whether any file is missing, extra or mismatched
+func (r VerifyReport) HasDifferences() bool {
+	for _, item := range r.Items {
+		if item.Status != VerifyUnverified && item.Status != VerifyError {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifier compares checksums of input files with output ones
+type Verifier struct {
+	opt          VerifyOpt
+	input        client.Client
+	output       client.Client
+	inputClient  client.Client
+	outputClient client.Client
+	inputTree    *client.TreeBuffer
+	outputTree   *client.TreeBuffer
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+func NewVerifier(input, output client.Client, opt VerifyOpt) *Verifier {
+	if opt.ThreadCount < 1 {
+		opt.ThreadCount = 1
+	}
+	v := &Verifier{
+		opt:          opt,
+		input:        input,
+		output:       output,
+		inputClient:  input,
+		outputClient: output,
+		inputTree:    client.NewTreeBuffer(input),
+		outputTree:   client.NewTreeBuffer(output),
+		stopCh:       make(chan struct{}),
+	}
+	if !opt.Filter.IsEmpty() {
+		v.inputTree.SetFilter(opt.Filter)
+	}
+	if outputFilter := opt.Filter.WithoutAge(); !outputFilter.IsEmpty() {
+		v.outputTree.SetFilter(outputFilter)
+	}
+	return v
+}
+
+func (v *Verifier) log(msg string) {
+	log.Info(fmt.Sprintf("Verify: %s", msg))
+}
+
+// Stop lets files being hashed finish but starts no new ones
+func (v *Verifier) Stop() {
+	v.stopOnce.Do(func() {
+		close(v.stopCh)
+	})
+}
+
+func (v *Verifier) isStopped(ctx context.Context) bool {
+	select {
+	case <-v.stopCh:
+		return true
+	case <-ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+func (v *Verifier) Verify(ctx context.Context, errors chan<- error) VerifyReport {
+	v.input = client.WithContext(v.inputClient, ctx)
+	v.output = client.WithContext(v.outputClient, ctx)
+	v.inputTree.SetClient(v.input)
+	v.outputTree.SetClient(v.output)
+
+	report := VerifyReport{
+		StartedAt: time.Now(),
+		State:     ReportComplete,
+		Items:     []VerifyItem{},
+		Errors:    []PathError{},
+	}
+	v.log("Reading trees...")
+	group := sync.WaitGroup{}
+	group.Add(2)
+	var inputErr, outputErr error
+	go func() {
+		inputErr = v.inputTree.Read()
+		group.Done()
+	}()
+	go func() {
+		outputErr = v.outputTree.Read()
+		group.Done()
+	}()
+	group.Wait()
+	for op, err := range map[string]error{"ReadInput": inputErr, "ReadOutput": outputErr} {
+		if err != nil {
+			errors <- err
+			report.Errors = append(report.Errors, PathError{Op: op, Error: err.Error()})
+		}
+	}
+	if len(report.Errors) > 0 {
+		report.State = ReportAborted
+		report.FinishedAt = time.Now()
+		return report
+	}
+
+	inputPaths := v.filePaths(v.inputTree)
+	outputPaths := v.filePaths(v.outputTree)
+	report.InputFiles = len(inputPaths)
+	report.OutputFiles = len(outputPaths)
+	both, missing, extra := util.Diff(inputPaths, outputPaths)
+	for _, path := range missing {
+		report.Items = append(report.Items, VerifyItem{Path: path, Status: VerifyMissing})
+	}
+	ignorer, _ := v.input.(client.Ignorer)
+	for _, path := range extra {
+		if v.inputTree.IsExcluded(path) || (ignorer != nil && ignorer.IsIgnored(path, false)) {
+			report.OutputFiles--
+			continue
+		}
+		report.Items = append(report.Items, VerifyItem{Path: path, Status: VerifyExtra})
+	}
+
+	v.log(fmt.Sprintf("Comparing %d files...", len(both)))
+	items, matched, stopped := v.compareFiles(ctx, util.PathSorted(both), errors)
+	report.Items = append(report.Items, items...)
+	report.Matched = matched
+	sort.SliceStable(report.Items, func(i, j int) bool {
+		return report.Items[i].Path < report.Items[j].Path
+	})
+	for _, item := range report.Items {
+		if item.Status == VerifyError {
+			report.Errors = append(report.Errors, PathError{Op: "Verify", Path: item.Path, Error: item.Detail})
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	if ctx.Err() != nil {
+		report.State = ReportAborted
+	} else if stopped {
+		report.State = ReportStopped
+	}
+	LogVerifyReport(report, v.log)
+	return report
+}
+
+func (v *Verifier) filePaths(tree *client.TreeBuffer) []string {
+	paths := []string{}
+	for path, res := range tree.GetChildren() {
+		if !res.IsDir {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+func (v *Verifier) compareFiles(ctx context.Context, paths []string, errors chan<- error) (items []VerifyItem, matched int, stopped bool) {
+	items = []VerifyItem{}
+	mu := sync.Mutex{}
+	pathsCh := make(chan string)
+	group := sync.WaitGroup{}
+	for i := uint(0); i < v.opt.ThreadCount; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for path := range pathsCh {
+				item, err := v.compareFile(path)
+				if err != nil {
+					errors <- err
+				}
+				mu.Lock()
+				if item.Status == "" {
+					matched++
+				} else {
+					items = append(items, item)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, path := range paths {
+		if v.isStopped(ctx) {
+			stopped = true
+			break
+		}
+		pathsCh <- path
+	}
+	close(pathsCh)
+	group.Wait()
+	return
+}
+
+// compareFile returns item with empty status when checksums matched
+func (v *Verifier) compareFile(path string) (item VerifyItem, err error) {
+	item.Path = path
+	input, _ := v.inputTree.GetChild(path)
+	output, _ := v.outputTree.GetChild(path)
+
+	if input.Size != output.Size {
+		item.Status = VerifySizeMismatch
+		item.Detail = fmt.Sprintf("input %d, output %d bytes", input.Size, output.Size)
+		return
+	}
+	if output.IsLocal() {
+		output, err = hashResource(v.output, path, output, nil)
+		if err != nil {
+			return v.failed(item, "output hashing", err)
+		}
+	}
+	// input is not read for nothing
+	if !mayCompareHashes(output) && !v.opt.Download {
+		item.Status = VerifyUnverified
+		item.Detail = "no comparable output checksum"
+		return
+	}
+	input, err = hashResource(v.input, path, input, v.limiter(input))
+	if err != nil {
+		return v.failed(item, "input hashing", err)
+	}
+	hashMatched, comparable := compareHashes(input, output)
+	if !comparable && v.opt.Download {
+		log.Debug(fmt.Sprintf("Verify: downloading %s", path))
+		output, err = hashResource(v.output, path, output, v.limiter(output))
+		if err != nil {
+			return v.failed(item, "output hashing", err)
+		}
+		hashMatched, comparable = compareHashes(input, output)
+	}
+	if !comparable {
+		item.Status = VerifyUnverified
+		item.Detail = "no comparable output checksum"
+		return
+	}
+	if !hashMatched {
+		item.Status = VerifyHashMismatch
+	}
+	return
+}
+
+// mayCompareHashes reports whether output checksums may match input hashes,
+// ETag only when it looks like MD5 or SHA256
+func mayCompareHashes(output client.Resource) bool {
+	if output.HashSha256 != "" || output.HashMd5 != "" {
+		return true
+	}
+	etag := output.HashETag
+	if len(etag) != 32 && len(etag) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(etag)
+	return err == nil
+}
+
+func (v *Verifier) failed(item VerifyItem, op string, err error) (VerifyItem, error) {
+	item.Status = VerifyError
+	item.Detail = fmt.Sprintf("%s: %v", op, err)
+	return item, err
+}
+
+func (v *Verifier) limiter(res client.Resource) *util.Limiter {
+	if res.IsLocal() {
+		return nil
+	}
+	return v.opt.Limiter
+}
+
+// LogVerifyReport prints differences and summary via logFn
+func LogVerifyReport(r VerifyReport, logFn func(msg string)) {
+	for _, item := range r.Items {
+		msg := fmt.Sprintf("%-12s %s", item.Status, item.Path)
+		if item.Detail != "" {
+			msg += fmt.Sprintf(" (%s)", item.Detail)
+		}
+		logFn(msg)
+	}
+	logFn(fmt.Sprintf("Summary (%s):", r.State))
+	logFn(fmt.Sprintf(
+		"  input files %d, output files %d, matched %d, missing %d, extra %d, size mismatched %d, hash mismatched %d, unverified %d, errors %d",
+		r.InputFiles,
+		r.OutputFiles,
+		r.Matched,
+		r.Count(VerifyMissing),
+		r.Count(VerifyExtra),
+		r.Count(VerifySizeMismatch),
+		r.Count(VerifyHashMismatch),
+		r.Count(VerifyUnverified),
+		r.Count(VerifyError),
+	))
+	logFn(fmt.Sprintf("  duration %s", r.FinishedAt.Sub(r.StartedAt).Round(time.Millisecond)))
+}
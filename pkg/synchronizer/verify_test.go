@@ -0,0 +1,130 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+)
+
+// remoteTestClient hides local nature of files, output exposes ETag only
+type remoteTestClient struct {
+	client.Client
+	etag    func(path string, res client.Resource) string
+	readErr error
+	reads   int32
+}
+
+func (c *remoteTestClient) ReadTree() (map[string]client.Resource, map[string]client.Resource, error) {
+	parents, children, err := c.Client.ReadTree()
+	for path, res := range children {
+		res.UserData = nil
+		res.HashETag = ""
+		if c.etag != nil && !res.IsDir {
+			res.HashETag = c.etag(path, res)
+		}
+		children[path] = res
+	}
+	return parents, children, err
+}
+
+func (c *remoteTestClient) ReadFile(path string) (io.ReadCloser, error) {
+	atomic.AddInt32(&c.reads, 1)
+	if c.readErr != nil {
+		return nil, c.readErr
+	}
+	return c.Client.ReadFile(path)
+}
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		etag       func(path string, res client.Resource) string
+		download   bool
+		readErr    error
+		status     VerifyStatus
+		inputReads int32
+	}{
+		{
+			name:       "local output",
+			output:     "content",
+			inputReads: 1,
+		},
+		{
+			name:   "ETag is not a hash",
+			output: "content",
+			etag:   func(string, client.Resource) string { return `"5f1a-3b"` },
+			status: VerifyUnverified,
+		},
+		{
+			name:       "ETag is MD5",
+			output:     "content",
+			etag:       func(string, client.Resource) string { return md5Hex("content") },
+			inputReads: 1,
+		},
+		{
+			name:       "ETag is MD5 of other content",
+			output:     "CONTENT",
+			etag:       func(string, client.Resource) string { return md5Hex("CONTENT") },
+			status:     VerifyUnverified,
+			inputReads: 1,
+		},
+		{
+			name:       "downloaded mismatch",
+			output:     "CONTENT",
+			etag:       func(string, client.Resource) string { return "x" },
+			download:   true,
+			status:     VerifyHashMismatch,
+			inputReads: 1,
+		},
+		{
+			name:       "download error",
+			output:     "content",
+			etag:       func(string, client.Resource) string { return "x" },
+			download:   true,
+			readErr:    fmt.Errorf("Connection reset"),
+			status:     VerifyError,
+			inputReads: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			in, out := newTestDir(t), newTestDir(t)
+			defer os.RemoveAll(in)
+			defer os.RemoveAll(out)
+			writeTestFiles(t, in, map[string]string{"/a": "content"}, time.Time{})
+			writeTestFiles(t, out, map[string]string{"/a": test.output}, time.Time{})
+
+			input := &remoteTestClient{Client: newTestClient(in)}
+			var output client.Client = newTestClient(out)
+			if test.etag != nil {
+				output = &remoteTestClient{Client: output, etag: test.etag, readErr: test.readErr}
+			}
+			v := NewVerifier(input, output, VerifyOpt{Download: test.download})
+			errors := make(chan error, 10)
+			report := v.Verify(context.Background(), errors)
+
+			status := VerifyStatus("")
+			if len(report.Items) == 1 {
+				status = report.Items[0].Status
+			} else if len(report.Items) > 1 {
+				t.Fatalf("unexpected items %+v", report.Items)
+			}
+			if status != test.status {
+				t.Errorf("status %q, expected %q", status, test.status)
+			}
+			if input.reads != test.inputReads {
+				t.Errorf("input read %d times, expected %d", input.reads, test.inputReads)
+			}
+			if differs := status == VerifyHashMismatch; report.HasDifferences() != differs {
+				t.Errorf("has differences %t, expected %t", report.HasDifferences(), differs)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package synchronizer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+	"github.com/io-developer/go-davsync/pkg/util"
+	"github.com/io-developer/go-davsync/pkg/watch"
+)
+
+// WatchOpt of continuous sync
+type WatchOpt struct {
+	// Debounce is a quiet period after the last change before sync
+	Debounce time.Duration
+	// MaxDelay limits debouncing of endless change bursts
+	MaxDelay time.Duration
+	// ReconcileInterval of full diff catching missed changes, zero disables it
+	ReconcileInterval time.Duration
+}
+
+// Watch syncs everything once, then syncs changed paths until stopped
+func (s *OneWay) Watch(ctx context.Context, w watch.Watcher, opt WatchOpt, errors chan<- error) SyncReport {
+	if opt.Debounce <= 0 {
+		opt.Debounce = 2 * time.Second
+	}
+	if opt.MaxDelay < opt.Debounce {
+		opt.MaxDelay = 10 * opt.Debounce
+	}
+
+	total := newSyncReport()
+	total.Merge(s.Sync(ctx, errors))
+
+	var reconcileCh <-chan time.Time
+	if opt.ReconcileInterval > 0 {
+		ticker := time.NewTicker(opt.ReconcileInterval)
+		defer ticker.Stop()
+		reconcileCh = ticker.C
+	}
+	debounce := time.NewTimer(opt.Debounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	pending := map[string]bool{}
+	firstChange := time.Time{}
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		paths := []string{}
+		for path := range pending {
+			paths = append(paths, path)
+		}
+		pending = map[string]bool{}
+		firstChange = time.Time{}
+		if containsPath(paths, watch.AllPaths) {
+			s.log("Watch: changes unknown, full sync..")
+			total.Merge(s.Sync(ctx, errors))
+			return
+		}
+		s.log(fmt.Sprintf("Watch: syncing %d changed paths..", len(paths)))
+		total.Merge(s.SyncPaths(ctx, paths, errors))
+	}
+
+	s.log("Watch: waiting for changes..")
+	for {
+		select {
+		case <-s.stopCh:
+			total.finish(ctx, false)
+			return total
+		case <-ctx.Done():
+			total.finish(ctx, false)
+			return total
+		case err := <-w.Errors():
+			errors <- err
+		case path := <-w.Paths():
+			pending[path] = true
+			if firstChange.IsZero() {
+				firstChange = time.Now()
+			}
+			if time.Now().Sub(firstChange) >= opt.MaxDelay {
+				flush()
+				continue
+			}
+			debounce.Stop()
+			select {
+			case <-debounce.C:
+			default:
+			}
+			debounce.Reset(opt.Debounce)
+		case <-debounce.C:
+			flush()
+		case <-reconcileCh:
+			s.log("Watch: reconciling with full diff..")
+			pending = map[string]bool{}
+			firstChange = time.Time{}
+			total.Merge(s.Sync(ctx, errors))
+		}
+	}
+}
+
+// SyncPaths refreshes given input paths and syncs only them and everything
+// below. Output tree is trusted as left by previous Sync
+func (s *OneWay) SyncPaths(ctx context.Context, paths []string, errors chan<- error) SyncReport {
+	s.bind(ctx)
+
+	s.report = newSyncReport()
+	timeStart := time.Now()
+
+	affected := []string{}
+	for _, path := range util.PathSorted(paths) {
+		if err := s.inputTree.Refresh(path); err != nil {
+			s.reportError("ReadInput", path, err)
+			errors <- err
+			continue
+		}
+		affected = append(affected, strings.TrimSuffix(util.PathNormalize(path, false), "/"))
+	}
+	s.diffPaths(
+		pathsUnder(s.inputTree.GetChildrenPaths(), affected),
+		pathsUnder(s.outputTree.GetChildrenPaths(), affected),
+	)
+	s.calcChanged()
+	s.moves = map[string]string{}
+	s.copies = map[string]string{}
+	plan := s.buildPlan()
+	s.emit(PlanEvent{EventBase: newEventBase(), Plan: plan})
+
+	s.report.PlanDuration = time.Now().Sub(timeStart)
+	return s.Execute(ctx, plan, errors)
+}
+
+// pathsUnder keeps paths equal to or inside any of dirs
+func pathsUnder(paths, dirs []string) []string {
+	under := []string{}
+	for _, path := range paths {
+		for _, dir := range dirs {
+			if path == dir || strings.HasPrefix(path, dir+"/") {
+				under = append(under, path)
+				break
+			}
+		}
+	}
+	return under
+}
+
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// applyResults keeps output tree up to date with executed plan,
+// so the next plan can be built without reading output again
+func (s *OneWay) applyResults(plan Plan, results map[PlanOp]*handleResult) {
+	for _, path := range resultDone(results[PlanMakeDir]) {
+		s.outputTree.SetChild(path, client.Resource{
+			Path:    path,
+			IsDir:   true,
+			ModTime: time.Now(),
+		})
+	}
+	moveSources := map[string]string{}
+	for _, item := range plan.Moves {
+		moveSources[item.Path] = item.Src
+	}
+	for _, path := range resultDone(results[PlanMove]) {
+		s.outputTree.RemoveChild(moveSources[path])
+	}
+	for _, op := range []PlanOp{PlanMove, PlanCopy, PlanUpload} {
+		for _, path := range resultDone(results[op]) {
+			if res, exists := s.inputTree.GetChild(path); exists {
+				res.UserData = nil // not a local file on output side
+				s.outputTree.SetChild(path, res)
+			}
+		}
+		if results[op] != nil {
+			for path := range results[op].Failed {
+				s.outputTree.RemoveChild(path)
+			}
+		}
+	}
+	for _, op := range []PlanOp{PlanDelete, PlanDeleteDir} {
+		for _, path := range resultDone(results[op]) {
+			s.outputTree.RemoveChild(path)
+		}
+	}
+}
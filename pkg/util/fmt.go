@@ -1,6 +1,11 @@
 package util
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
 
 func FormatBytes(size int64) string {
 	if size < 1024 {
@@ -18,3 +23,21 @@ func FormatBytes(size int64) string {
 	suffixes := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
 	return fmt.Sprintf("%.1f %s", val, suffixes[exp])
 }
+
+// ParseBytes parses size like "512", "10K", "1.5MiB", "2G"
+func ParseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	num := strings.TrimRightFunc(s, unicode.IsLetter)
+	suffix := strings.ToUpper(strings.TrimSpace(s[len(num):]))
+	suffix = strings.TrimSuffix(strings.TrimSuffix(suffix, "B"), "I")
+	exps := map[string]uint{"": 0, "K": 1, "M": 2, "G": 3, "T": 4, "P": 5}
+	exp, ok := exps[suffix]
+	if !ok {
+		return 0, fmt.Errorf("Unexpected size suffix '%s'", s[len(num):])
+	}
+	val, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(val * float64(uint64(1)<<(10*exp))), nil
+}
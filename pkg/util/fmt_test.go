@@ -0,0 +1,39 @@
+package util
+
+import "testing"
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		s    string
+		size int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"512B", 512},
+		{"10K", 10 << 10},
+		{"10k", 10 << 10},
+		{"10 KB", 10 << 10},
+		{"1.5MiB", 3 << 19},
+		{"2G", 2 << 30},
+		{"1T", 1 << 40},
+		{" 256M ", 256 << 20},
+	}
+	for _, test := range tests {
+		size, err := ParseBytes(test.s)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.s, err)
+			continue
+		}
+		if size != test.size {
+			t.Errorf("%q: size %d, expected %d", test.s, size, test.size)
+		}
+	}
+}
+
+func TestParseBytesErrors(t *testing.T) {
+	for _, s := range []string{"", "M", "10X", "10MX", "ten"} {
+		if _, err := ParseBytes(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket shared by all readers it wraps.
+// Rate is bytes per second, zero rate is unlimited
+type Limiter struct {
+	mu       sync.Mutex
+	rateFn   func(t time.Time) int64
+	tokens   float64
+	lastTime time.Time
+	lastRate int64
+}
+
+func NewLimiter(rate int64) *Limiter {
+	return NewScheduledLimiter(func(time.Time) int64 {
+		return rate
+	})
+}
+
+// NewScheduledLimiter takes rate at the moment of each read
+func NewScheduledLimiter(rateFn func(t time.Time) int64) *Limiter {
+	return &Limiter{
+		rateFn:   rateFn,
+		lastTime: time.Now(),
+	}
+}
+
+// Wait consumes n bytes, sleeping while the bucket is in debt
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	delay := l.reserve(n)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *Limiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	rate := l.rateFn(now)
+	if rate <= 0 {
+		l.tokens = 0
+		l.lastTime = now
+		l.lastRate = rate
+		return 0
+	}
+	if rate != l.lastRate {
+		// start new rate with a full second of burst
+		l.tokens = float64(rate)
+		l.lastRate = rate
+	} else {
+		l.tokens += now.Sub(l.lastTime).Seconds() * float64(rate)
+		if l.tokens > float64(rate) {
+			l.tokens = float64(rate)
+		}
+	}
+	l.lastTime = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+}
+
+// LimitedReader waits for limiter after each read
+type LimitedReader struct {
+	io.ReadCloser
+
+	ctx     context.Context
+	reader  io.ReadCloser
+	limiter *Limiter
+}
+
+// limitedReadChunk keeps throttling smooth for big read buffers
+const limitedReadChunk = 32 * 1024
+
+func NewLimitedReader(ctx context.Context, r io.ReadCloser, l *Limiter) *LimitedReader {
+	return &LimitedReader{
+		ctx:     ctx,
+		reader:  r,
+		limiter: l,
+	}
+}
+
+func (r *LimitedReader) Read(p []byte) (n int, err error) {
+	if len(p) > limitedReadChunk {
+		p = p[:limitedReadChunk]
+	}
+	n, err = r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.Wait(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return
+}
+
+func (r *LimitedReader) Close() error {
+	return r.reader.Close()
+}
+
+// ParseRateSchedule parses "2M" or "08:00-19:00 2M, 19:00-23:00 10M, otherwise unlimited".
+// Ranges may wrap midnight, the first matching range wins
+func ParseRateSchedule(s string) (func(t time.Time) int64, error) {
+	type rateRange struct {
+		from, to int
+		rate     int64
+	}
+	ranges := []rateRange{}
+	otherwise := int64(0)
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.Fields(part)
+		switch {
+		case len(fields) == 1:
+			rate, err := parseRate(fields[0])
+			if err != nil {
+				return nil, err
+			}
+			otherwise = rate
+		case len(fields) == 2 && fields[0] == "otherwise":
+			rate, err := parseRate(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			otherwise = rate
+		case len(fields) == 2:
+			bounds := strings.Split(fields[0], "-")
+			if len(bounds) != 2 {
+				return nil, fmt.Errorf("Unexpected time range '%s'", fields[0])
+			}
+			from, err := parseDayMinute(bounds[0])
+			if err != nil {
+				return nil, err
+			}
+			to, err := parseDayMinute(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+			rate, err := parseRate(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			ranges = append(ranges, rateRange{from, to, rate})
+		default:
+			return nil, fmt.Errorf("Unexpected rate schedule part '%s'", strings.TrimSpace(part))
+		}
+	}
+	return func(t time.Time) int64 {
+		minute := t.Hour()*60 + t.Minute()
+		for _, r := range ranges {
+			inRange := minute >= r.from && minute < r.to
+			if r.from > r.to {
+				inRange = minute >= r.from || minute < r.to
+			}
+			if inRange {
+				return r.rate
+			}
+		}
+		return otherwise
+	}, nil
+}
+
+func parseRate(s string) (int64, error) {
+	if s == "unlimited" || s == "off" {
+		return 0, nil
+	}
+	return ParseBytes(s)
+}
+
+func parseDayMinute(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("Unexpected time '%s'", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
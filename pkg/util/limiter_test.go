@@ -0,0 +1,58 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRateSchedule(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2024, 1, 10, hour, min, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		schedule string
+		at       time.Time
+		rate     int64
+	}{
+		{"2M", at(12, 0), 2 << 20},
+		{"unlimited", at(12, 0), 0},
+		{"08:00-19:00 2M, 19:00-23:00 10M, otherwise unlimited", at(7, 59), 0},
+		{"08:00-19:00 2M, 19:00-23:00 10M, otherwise unlimited", at(8, 0), 2 << 20},
+		{"08:00-19:00 2M, 19:00-23:00 10M, otherwise unlimited", at(19, 0), 10 << 20},
+		{"08:00-19:00 2M, 19:00-23:00 10M, otherwise unlimited", at(23, 0), 0},
+		{"08:00-19:00 2M, otherwise 500K", at(20, 0), 500 << 10},
+		{"08:00-19:00 2M, 1M", at(20, 0), 1 << 20},
+		// wraps midnight
+		{"22:00-06:00 off, otherwise 1M", at(23, 30), 0},
+		{"22:00-06:00 off, otherwise 1M", at(5, 59), 0},
+		{"22:00-06:00 off, otherwise 1M", at(6, 0), 1 << 20},
+		// first matching range wins
+		{"08:00-12:00 1M, 10:00-14:00 3M", at(11, 0), 1 << 20},
+		{"08:00-12:00 1M, 10:00-14:00 3M", at(13, 0), 3 << 20},
+	}
+	for _, test := range tests {
+		rateAt, err := ParseRateSchedule(test.schedule)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.schedule, err)
+			continue
+		}
+		if rate := rateAt(test.at); rate != test.rate {
+			t.Errorf("%q at %s: rate %d, expected %d", test.schedule, test.at.Format("15:04"), rate, test.rate)
+		}
+	}
+}
+
+func TestParseRateScheduleErrors(t *testing.T) {
+	for _, s := range []string{
+		"2X",
+		"08:00 2M",
+		"08:00-25:00 2M",
+		"8-19 2M",
+		"08:00-19:00 2M 3M",
+		"otherwise",
+	} {
+		if _, err := ParseRateSchedule(s); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
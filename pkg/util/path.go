@@ -64,6 +64,15 @@ func PathSorted(paths []string) []string {
 	return sorted
 }
 
+func PathSortedDeepestFirst(paths []string) []string {
+	sorted := PathSorted(paths)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return strings.Count(strings.TrimSuffix(sorted[i], "/"), "/") >
+			strings.Count(strings.TrimSuffix(sorted[j], "/"), "/")
+	})
+	return sorted
+}
+
 func PathSortedDirs(paths []string) []string {
 	re := regexp.MustCompile("^.*/")
 	dict := map[string]string{}
@@ -1,7 +1,10 @@
 package util
 
 import (
+	"context"
 	"crypto"
+	_ "crypto/md5" // registers hashes for programs not importing net/http
+	_ "crypto/sha256"
 	"fmt"
 	"hash"
 	"io"
@@ -79,6 +82,32 @@ func (r *Reader) Close() error {
 	return r.reader.Close()
 }
 
+// ContextReader fails reading as soon as context is done
+type ContextReader struct {
+	io.ReadCloser
+
+	ctx    context.Context
+	reader io.ReadCloser
+}
+
+func NewContextReader(ctx context.Context, r io.ReadCloser) *ContextReader {
+	return &ContextReader{
+		ctx:    ctx,
+		reader: r,
+	}
+}
+
+func (r *ContextReader) Read(p []byte) (n int, err error) {
+	if err = r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
+
+func (r *ContextReader) Close() error {
+	return r.reader.Close()
+}
+
 func (r *Reader) updateHash(p []byte, n int) error {
 	if n < 1 {
 		return nil
@@ -0,0 +1,137 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/io-developer/go-davsync/pkg/util"
+)
+
+// Notifier watches local dir recursively with filesystem notifications
+type Notifier struct {
+	baseDir string
+	watcher *fsnotify.Watcher
+	paths   chan string
+	errors  chan error
+	cancel  context.CancelFunc
+}
+
+// NewNotifier adds watches to every dir below baseDir
+func NewNotifier(baseDir string) (Watcher, error) {
+	baseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("Filesystem notifications init error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n := &Notifier{
+		baseDir: baseDir,
+		watcher: watcher,
+		paths:   make(chan string),
+		errors:  make(chan error),
+		cancel:  cancel,
+	}
+	if _, err = n.addTree(baseDir); err != nil {
+		n.Close()
+		return nil, err
+	}
+	go n.run(ctx)
+	return n, nil
+}
+
+func (n *Notifier) Paths() <-chan string {
+	return n.paths
+}
+
+func (n *Notifier) Errors() <-chan error {
+	return n.errors
+}
+
+func (n *Notifier) Close() error {
+	n.cancel()
+	return n.watcher.Close()
+}
+
+// addTree watches dir and its subdirs, returns all paths found inside
+func (n *Notifier) addTree(absDir string) (found []string, err error) {
+	err = filepath.Walk(absDir, func(absPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			// vanished while walking, deletion event follows
+			return nil
+		}
+		found = append(found, n.toRelPath(absPath))
+		if !info.IsDir() {
+			return nil
+		}
+		if err := n.watcher.Add(absPath); err != nil {
+			return fmt.Errorf("Filesystem watch error '%s': %v", absPath, err)
+		}
+		return nil
+	})
+	return
+}
+
+func (n *Notifier) toRelPath(absPath string) string {
+	return util.PathRel(absPath, n.baseDir)
+}
+
+func (n *Notifier) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-n.watcher.Events:
+			if !ok {
+				return
+			}
+			n.handle(ctx, event)
+		case err, ok := <-n.watcher.Errors:
+			if !ok {
+				return
+			}
+			if err == fsnotify.ErrEventOverflow {
+				n.send(ctx, AllPaths)
+				continue
+			}
+			n.sendError(ctx, err)
+		}
+	}
+}
+
+func (n *Notifier) handle(ctx context.Context, event fsnotify.Event) {
+	if event.Has(fsnotify.Create) {
+		// new dirs are not watched yet, neither are paths created inside meanwhile
+		if info, err := os.Lstat(event.Name); err == nil && info.IsDir() {
+			found, err := n.addTree(event.Name)
+			if err != nil {
+				n.sendError(ctx, err)
+			}
+			for _, path := range found {
+				n.send(ctx, path)
+			}
+			return
+		}
+	}
+	n.send(ctx, n.toRelPath(event.Name))
+}
+
+func (n *Notifier) send(ctx context.Context, path string) {
+	select {
+	case n.paths <- path:
+	case <-ctx.Done():
+	}
+}
+
+func (n *Notifier) sendError(ctx context.Context, err error) {
+	select {
+	case n.errors <- err:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,127 @@
+package watch
+
+import (
+	"context"
+	"time"
+
+	"github.com/io-developer/go-davsync/pkg/client"
+)
+
+// AllPaths is sent when changes can not be told precisely, e.g. on
+// notification queue overflow. Full diff is expected then
+const AllPaths = "/"
+
+// Watcher reports relative paths changed in tree. Dir paths may come
+// with or without trailing slash, deleted ones never have it
+type Watcher interface {
+	Paths() <-chan string
+	Errors() <-chan error
+	Close() error
+}
+
+// Poller detects changes by comparing trees read periodically
+type Poller struct {
+	client   client.Client
+	interval time.Duration
+	paths    chan string
+	errors   chan error
+	cancel   context.CancelFunc
+}
+
+type pollEntry struct {
+	isDir   bool
+	size    int64
+	modTime time.Time
+}
+
+// NewPoller starts polling, first tree read is a baseline
+func NewPoller(c client.Client, interval time.Duration) *Poller {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Poller{
+		client:   c,
+		interval: interval,
+		paths:    make(chan string),
+		errors:   make(chan error),
+		cancel:   cancel,
+	}
+	go p.run(ctx)
+	return p
+}
+
+func (p *Poller) Paths() <-chan string {
+	return p.paths
+}
+
+func (p *Poller) Errors() <-chan error {
+	return p.errors
+}
+
+func (p *Poller) Close() error {
+	p.cancel()
+	return nil
+}
+
+func (p *Poller) run(ctx context.Context) {
+	prev, err := p.read()
+	if err != nil {
+		p.sendError(ctx, err)
+	}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cur, err := p.read()
+		if err != nil {
+			p.sendError(ctx, err)
+			continue
+		}
+		for path, entry := range cur {
+			if prevEntry, exists := prev[path]; !exists || prevEntry != entry {
+				p.send(ctx, path)
+			}
+		}
+		for path := range prev {
+			if _, exists := cur[path]; !exists {
+				p.send(ctx, path)
+			}
+		}
+		prev = cur
+	}
+}
+
+func (p *Poller) read() (map[string]pollEntry, error) {
+	_, children, err := p.client.ReadTree()
+	if err != nil {
+		return nil, err
+	}
+	entries := map[string]pollEntry{}
+	for path, res := range children {
+		if path == AllPaths {
+			continue
+		}
+		entries[path] = pollEntry{
+			isDir:   res.IsDir,
+			size:    res.Size,
+			modTime: res.ModTime,
+		}
+	}
+	return entries, nil
+}
+
+func (p *Poller) send(ctx context.Context, path string) {
+	select {
+	case p.paths <- path:
+	case <-ctx.Done():
+	}
+}
+
+func (p *Poller) sendError(ctx context.Context, err error) {
+	select {
+	case p.errors <- err:
+	case <-ctx.Done():
+	}
+}